@@ -0,0 +1,110 @@
+package dara
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+var globalBandwidth = struct {
+	sync.RWMutex
+	upload   *bandwidthLimiter
+	download *bandwidthLimiter
+}{}
+
+// SetGlobalBandwidthLimit limits the upload and download bytes per second shared by
+// every request of the process. 0 removes the limit.
+func SetGlobalBandwidthLimit(upload, download int) {
+	globalBandwidth.Lock()
+	defer globalBandwidth.Unlock()
+	globalBandwidth.upload = newBandwidthLimiter(upload)
+	globalBandwidth.download = newBandwidthLimiter(download)
+}
+
+func getGlobalBandwidthLimiters() (upload, download *bandwidthLimiter) {
+	globalBandwidth.RLock()
+	defer globalBandwidth.RUnlock()
+	return globalBandwidth.upload, globalBandwidth.download
+}
+
+// bandwidthLimiter is a token bucket refilled with rate bytes per second
+type bandwidthLimiter struct {
+	sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidthLimiter(rate int) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{
+		rate: int64(rate),
+		last: time.Now(),
+	}
+}
+
+// wait blocks until n more bytes fit into the rate
+func (limiter *bandwidthLimiter) wait(n int) {
+	limiter.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * float64(limiter.rate)
+	if limiter.tokens > float64(limiter.rate) {
+		limiter.tokens = float64(limiter.rate)
+	}
+	limiter.last = now
+	limiter.tokens -= float64(n)
+	var delay time.Duration
+	if limiter.tokens < 0 {
+		delay = time.Duration(-limiter.tokens / float64(limiter.rate) * float64(time.Second))
+	}
+	limiter.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// chunk is the largest read allowed at once, a tenth of a second of the rate
+func (limiter *bandwidthLimiter) chunk() int {
+	chunk := int(limiter.rate / 10)
+	if chunk < 1 {
+		chunk = 1
+	}
+	return chunk
+}
+
+// throttledReader streams through its limiters without buffering
+type throttledReader struct {
+	io.ReadCloser
+	limiters []*bandwidthLimiter
+}
+
+// newThrottledReader returns body unchanged when there is no limiter
+func newThrottledReader(body io.ReadCloser, limiters ...*bandwidthLimiter) io.ReadCloser {
+	active := make([]*bandwidthLimiter, 0, len(limiters))
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+	if len(active) == 0 {
+		return body
+	}
+	return &throttledReader{ReadCloser: body, limiters: active}
+}
+
+func (reader *throttledReader) Read(p []byte) (n int, err error) {
+	for _, limiter := range reader.limiters {
+		if chunk := limiter.chunk(); len(p) > chunk {
+			p = p[:chunk]
+		}
+	}
+	n, err = reader.ReadCloser.Read(p)
+	if n > 0 {
+		for _, limiter := range reader.limiters {
+			limiter.wait(n)
+		}
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_bandwidthLimiter(t *testing.T) {
+	utils.AssertNil(t, newBandwidthLimiter(0))
+	limiter := newBandwidthLimiter(1000)
+	utils.AssertEqual(t, 100, limiter.chunk())
+	utils.AssertEqual(t, 1, newBandwidthLimiter(5).chunk())
+
+	start := time.Now()
+	limiter.wait(100)
+	utils.AssertEqual(t, true, time.Since(start) >= 90*time.Millisecond)
+
+	body := ioutil.NopCloser(strings.NewReader("body"))
+	utils.AssertEqual(t, body, newThrottledReader(body, nil, nil))
+}
+
+func Test_throttledReader(t *testing.T) {
+	reader := newThrottledReader(ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 200))), newBandwidthLimiter(2000))
+	start := time.Now()
+	byt, err := ioutil.ReadAll(reader)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, len(byt))
+	utils.AssertEqual(t, true, time.Since(start) >= 90*time.Millisecond)
+}
+
+func Test_DoRequestWithBandwidthLimit(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			byt, err := ioutil.ReadAll(req.Body)
+			utils.AssertNil(t, err)
+			utils.AssertEqual(t, true, len(byt) >= 100)
+			return mockResponse(200, "data: "+strings.Repeat("b", 94)+"\n\n", nil)
+		}
+	}
+
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Body = strings.NewReader(strings.Repeat("a", 100))
+	start := time.Now()
+	resp, err := DoRequest(request, NewRuntimeObject(map[string]interface{}{
+		"uploadBandwidthLimit":   1000,
+		"downloadBandwidthLimit": 1000,
+	}))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, time.Since(start) >= 90*time.Millisecond)
+
+	start = time.Now()
+	events := make(chan *SSEEvent, 1)
+	errs := make(chan error, 1)
+	ReadAsSSE(resp.Body, events, errs)
+	event := <-events
+	utils.AssertEqual(t, 94, len(StringValue(event.Data)))
+	utils.AssertNil(t, <-errs)
+	utils.AssertEqual(t, true, time.Since(start) >= 90*time.Millisecond)
+
+	SetGlobalBandwidthLimit(1000, 0)
+	defer SetGlobalBandwidthLimit(0, 0)
+	file := new(FileField).SetFilename("a.txt").SetContentType("text/plain").SetContent(strings.NewReader(strings.Repeat("a", 100)))
+	request.Body = ToFileForm(map[string]interface{}{"file": file}, "boundary")
+	start = time.Now()
+	_, err = DoRequest(request, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, time.Since(start) >= 90*time.Millisecond)
+	upload, download := getGlobalBandwidthLimiters()
+	utils.AssertNotNil(t, upload)
+	utils.AssertNil(t, download)
+}
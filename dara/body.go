@@ -0,0 +1,327 @@
+package dara
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// unknownBodySize is the size of the section reader an io.ReaderAt body is
+// read through, the length of the body is not known
+const unknownBodySize = math.MaxInt64
+
+// readBodyBytes reads the whole body of request without losing it: seekable
+// bodies are rewound, other bodies are replaced with an in-memory copy.
+func readBodyBytes(request *Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+	if seeker, ok := request.Body.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			byt, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				return nil, err
+			}
+			_, err = seeker.Seek(offset, io.SeekStart)
+			return byt, err
+		}
+	}
+	byt, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body = bytes.NewReader(byt)
+	return byt, nil
+}
+
+// readBodyPrefix reads up to limit bytes of the body of request and reports
+// whether that is the whole body. The body is left readable from where it
+// was: seekable bodies are rewound, other bodies are replaced with a reader
+// which yields the bytes read first.
+func readBodyPrefix(request *Request, limit int64) ([]byte, bool, error) {
+	if request.Body == nil {
+		return nil, true, nil
+	}
+	offset := int64(-1)
+	seeker, ok := request.Body.(io.Seeker)
+	if ok {
+		if current, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			offset = current
+		}
+	}
+	byt, err := ioutil.ReadAll(io.LimitReader(request.Body, limit+1))
+	complete := int64(len(byt)) <= limit
+	if err != nil {
+		return nil, false, err
+	}
+	if offset >= 0 {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else if complete {
+		request.Body = bytes.NewReader(byt)
+	} else {
+		request.Body = io.MultiReader(bytes.NewReader(byt), request.Body)
+	}
+	if !complete {
+		byt = byt[:limit]
+	}
+	return byt, complete, err
+}
+
+// prepareRequestBody makes the body of request readable again on the next
+// DoRequest call. A seekable body is rewound to the offset it had when it was
+// first sent, an io.ReaderAt is read from its start and other bodies are
+// spooled when runtime allows it. A body set back to the reader it was first
+// given, as a retry building a new request with SetRetryPolicyContext does,
+// is sent again too. It returns nil when the body can not be replayed.
+func prepareRequestBody(request *Request, runtimeObject *RuntimeObject) (func() (io.ReadCloser, error), error) {
+	if request.Body == nil {
+		request.releaseBody()
+		return nil, nil
+	}
+	if request.bodySource != nil && sameReader(request.bodyOrigin, request.Body) {
+		// the reader given to an earlier attempt, sent again from what was kept of it
+		request.Body = request.bodySource
+	}
+	if !sameReader(request.bodySource, request.Body) {
+		// the body was replaced, the spool of the previous one is not needed anymore
+		request.releaseBody()
+		origin := request.Body
+		if seeker, ok := request.Body.(io.Seeker); ok && isSeekable(seeker) {
+			request.bodyOffset, _ = seeker.Seek(0, io.SeekCurrent)
+		} else if readerAt, ok := request.Body.(io.ReaderAt); ok && canReadAt(request.Body) {
+			request.Body = io.NewSectionReader(readerAt, 0, unknownBodySize)
+			request.bodyOffset = 0
+		} else {
+			limit := IntValue(runtimeObject.BodySpoolLimit)
+			if limit <= 0 {
+				return nil, nil
+			}
+			memoryLimit := limit
+			if runtimeObject.BodyMemoryLimit != nil {
+				memoryLimit = IntValue(runtimeObject.BodyMemoryLimit)
+			}
+			spooled, replayable, err := spoolBody(request.Body, limit, memoryLimit)
+			if err != nil {
+				return nil, err
+			}
+			request.Body = spooled
+			if !replayable {
+				return nil, nil
+			}
+			request.spool, _ = spooled.(*spooledFile)
+			request.bodyOffset = 0
+		}
+		request.bodyOrigin = origin
+		request.bodySource = request.Body
+	}
+	seeker := request.Body.(io.Seeker)
+	if _, err := seeker.Seek(request.bodyOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		if _, err := seeker.Seek(request.bodyOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(request.Body), nil
+	}, nil
+}
+
+// Close removes the temporary file a body spooled by DoRequest is kept in.
+// Call it once the request is not sent again.
+func (request *Request) Close() error {
+	return request.releaseBody()
+}
+
+func (request *Request) releaseBody() error {
+	spool := request.spool
+	request.spool = nil
+	if spool == nil {
+		return nil
+	}
+	if sameReader(request.bodySource, spool) {
+		request.bodySource = nil
+		request.bodyOrigin = nil
+	}
+	return spool.Close()
+}
+
+// takeBody makes request send the body of previous again when it was given
+// the same reader, the spool of previous moves to request. The spool of a
+// body which is not sent again is released.
+func (request *Request) takeBody(previous *Request) {
+	if previous == nil || previous == request {
+		return
+	}
+	if previous.bodySource == nil || !sameReader(previous.bodyOrigin, request.Body) {
+		previous.releaseBody()
+		return
+	}
+	request.bodyOrigin = previous.bodyOrigin
+	request.bodySource = previous.bodySource
+	request.bodyOffset = previous.bodyOffset
+	request.spool = previous.spool
+	previous.spool = nil
+}
+
+// canReadAt reports whether the ReadAt of reader works. Files which can not
+// seek, like pipes, fail to read at an offset.
+func canReadAt(reader io.Reader) bool {
+	_, isFile := reader.(*os.File)
+	return !isFile
+}
+
+// isSeekable reports whether seeker supports seeking, pipes and sockets do not
+func isSeekable(seeker io.Seeker) bool {
+	_, err := seeker.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+// sameReader reports whether a and b are the same reader without panicking on
+// readers which can not be compared
+func sameReader(a, b io.Reader) bool {
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// spoolBody reads up to limit bytes of body, keeping memoryLimit bytes in
+// memory and the rest in a temporary file. The returned reader yields the
+// whole body and is replayable when body was not longer than limit. A body
+// which is not replayable removes its temporary file once closed.
+func spoolBody(body io.Reader, limit, memoryLimit int) (io.Reader, bool, error) {
+	if memoryLimit > limit {
+		memoryLimit = limit
+	}
+	buf := make([]byte, memoryLimit+1)
+	n, err := io.ReadFull(body, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return bytes.NewReader(buf[:n]), true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if memoryLimit == limit {
+		return io.MultiReader(bytes.NewReader(buf[:n]), body), false, nil
+	}
+
+	file, err := ioutil.TempFile("", "dara-body-")
+	if err != nil {
+		return nil, false, err
+	}
+	// the name is removed at once where the system allows it, so the file
+	// does not outlive the process
+	spooled := &spooledFile{File: file, removed: os.Remove(file.Name()) == nil}
+	if _, err = file.Write(buf[:n]); err != nil {
+		spooled.Close()
+		return nil, false, err
+	}
+	written, err := io.CopyN(file, body, int64(limit-n+1))
+	if err != nil && err != io.EOF {
+		spooled.Close()
+		return nil, false, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, false, err
+	}
+	if int64(n)+written <= int64(limit) {
+		return spooled, true, nil
+	}
+	return &spooledStream{Reader: io.MultiReader(spooled, body), file: spooled}, false, nil
+}
+
+// spooledFile is a temporary file holding a request body, it is removed once closed
+type spooledFile struct {
+	*os.File
+	removed bool
+}
+
+func (file *spooledFile) Close() error {
+	err := file.File.Close()
+	if !file.removed {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// spooledStream is a body longer than the spool limit, its beginning read
+// from a temporary file which is removed when the transport closes the body
+type spooledStream struct {
+	io.Reader
+	file *spooledFile
+}
+
+func (stream *spooledStream) Close() error {
+	return stream.file.Close()
+}
+
+// setContentLength sets the length of the body of httpRequest from the
+// content-length header or from the body itself, so that it is not sent chunked
+func setContentLength(httpRequest *http.Request, request *Request) {
+	if httpRequest.Body == nil || httpRequest.Body == http.NoBody {
+		return
+	}
+	length := int64(-1)
+	if value := getHeaderValue(request.Headers, "content-length"); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			length = parsed
+		}
+	} else {
+		length = bodyLength(request.Body)
+	}
+	if length < 0 {
+		return
+	}
+	httpRequest.ContentLength = length
+	if length == 0 {
+		httpRequest.Body = http.NoBody
+	}
+}
+
+// bodyLength returns the number of bytes left in body, -1 when it is unknown
+func bodyLength(body io.Reader) int64 {
+	switch reader := body.(type) {
+	case *bytes.Buffer:
+		return int64(reader.Len())
+	case *bytes.Reader:
+		return int64(reader.Len())
+	case *strings.Reader:
+		return int64(reader.Len())
+	case *io.SectionReader:
+		if reader.Size() == unknownBodySize {
+			return -1
+		}
+		offset, err := reader.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return reader.Size() - offset
+	case *os.File:
+		return fileLength(reader)
+	case *spooledFile:
+		return fileLength(reader.File)
+	case *FileFormReader:
+		return reader.length()
+	}
+	return -1
+}
+
+// fileLength returns the number of bytes left in a regular file
+func fileLength(file *os.File) int64 {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	return info.Size() - offset
+}
@@ -0,0 +1,391 @@
+package dara
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_readBodyBytes(t *testing.T) {
+	request := NewRequest()
+	byt, err := readBodyBytes(request)
+	utils.AssertNil(t, err)
+	utils.AssertNil(t, byt)
+
+	reader := strings.NewReader("seekable")
+	reader.Seek(4, 0)
+	request.Body = reader
+	byt, err = readBodyBytes(request)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "able", string(byt))
+	utils.AssertEqual(t, 4, reader.Len())
+
+	request.Body = bytes.NewBufferString("buffer")
+	byt, err = readBodyBytes(request)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "buffer", string(byt))
+	byt, err = ioutil.ReadAll(request.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "buffer", string(byt))
+}
+
+type readerAtOnly struct {
+	reader *strings.Reader
+}
+
+func (body *readerAtOnly) Read(p []byte) (int, error) {
+	return body.reader.Read(p)
+}
+
+func (body *readerAtOnly) ReadAt(p []byte, off int64) (int, error) {
+	return body.reader.ReadAt(p, off)
+}
+
+func Test_DoRequestReplaysBody(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var received, replayed []string
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			byt, _ := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			received = append(received, string(byt))
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				utils.AssertNil(t, err)
+				byt, _ = ioutil.ReadAll(body)
+				replayed = append(replayed, string(byt))
+			} else {
+				replayed = append(replayed, "<nil>")
+			}
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+	send := func(request *Request, runtime *RuntimeObject) {
+		_, err := DoRequest(request, runtime)
+		utils.AssertNil(t, err)
+	}
+
+	request := NewRequest()
+	request.Method = String("POST")
+	reader := strings.NewReader("seekable")
+	reader.Seek(4, io.SeekStart)
+	request.Body = reader
+	send(request, nil)
+	send(request, nil)
+	utils.AssertEqual(t, []string{"able", "able"}, received)
+	utils.AssertEqual(t, []string{"able", "able"}, replayed)
+
+	tempDir, err := ioutil.TempDir("", "body")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "body")
+	utils.AssertNil(t, ioutil.WriteFile(path, []byte("file"), 0644))
+	file, err := os.Open(path)
+	utils.AssertNil(t, err)
+	defer file.Close()
+	received, replayed = nil, nil
+	request.Body = file
+	send(request, nil)
+	send(request, nil)
+	utils.AssertEqual(t, []string{"file", "file"}, received)
+	utils.AssertEqual(t, []string{"file", "file"}, replayed)
+
+	received, replayed = nil, nil
+	request.Body = &readerAtOnly{reader: strings.NewReader("reader at")}
+	send(request, nil)
+	send(request, nil)
+	utils.AssertEqual(t, []string{"reader at", "reader at"}, received)
+	utils.AssertEqual(t, []string{"reader at", "reader at"}, replayed)
+
+	// non-seekable bodies are only replayed when spooling is enabled
+	received, replayed = nil, nil
+	request.Body = &chunkReader{data: "stream", chunk: 1}
+	send(request, nil)
+	utils.AssertEqual(t, []string{"stream"}, received)
+	utils.AssertEqual(t, []string{"<nil>"}, replayed)
+
+	received, replayed = nil, nil
+	runtime := &RuntimeObject{BodySpoolLimit: Int(16)}
+	request.Body = &chunkReader{data: "in memory", chunk: 1}
+	send(request, runtime)
+	send(request, runtime)
+	utils.AssertEqual(t, []string{"in memory", "in memory"}, received)
+	utils.AssertEqual(t, []string{"in memory", "in memory"}, replayed)
+
+	received, replayed = nil, nil
+	runtime = &RuntimeObject{BodySpoolLimit: Int(16), BodyMemoryLimit: Int(4)}
+	request.Body = &chunkReader{data: "temporary file", chunk: 1}
+	send(request, runtime)
+	send(request, runtime)
+	utils.AssertEqual(t, []string{"temporary file", "temporary file"}, received)
+	utils.AssertEqual(t, []string{"temporary file", "temporary file"}, replayed)
+	spooled, ok := request.Body.(*spooledFile)
+	utils.AssertEqual(t, true, ok)
+	// the name of the temporary file is gone while the body is still readable
+	exists, _ := Exists(spooled.Name())
+	utils.AssertEqual(t, false, exists)
+	utils.AssertNil(t, request.Close())
+	_, err = spooled.Stat()
+	utils.AssertNotNil(t, err)
+	utils.AssertNil(t, request.Close())
+
+	// replacing the body releases the spool of the previous one
+	request.Body = &chunkReader{data: "temporary file", chunk: 1}
+	send(request, runtime)
+	spooled = request.Body.(*spooledFile)
+	received, replayed = nil, nil
+	request.Body = &chunkReader{data: "longer than the limit", chunk: 1}
+	send(request, runtime)
+	utils.AssertEqual(t, []string{"longer than the limit"}, received)
+	utils.AssertEqual(t, []string{"<nil>"}, replayed)
+	_, err = spooled.Stat()
+	utils.AssertNotNil(t, err)
+	// the transport closes a body longer than the limit, removing its file
+	stream, ok := request.Body.(*spooledStream)
+	utils.AssertEqual(t, true, ok)
+	_, err = stream.file.Stat()
+	utils.AssertNotNil(t, err)
+}
+
+func Test_DoRequestReplaysBodyInNewRequest(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var received []string
+	failures := 0
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			byt, _ := ioutil.ReadAll(req.Body)
+			received = append(received, string(byt))
+			status := 200
+			if failures > 0 {
+				failures--
+				status = 503
+			}
+			return &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+	runtime := &RuntimeObject{
+		BodySpoolLimit:  Int(16),
+		BodyMemoryLimit: Int(4),
+		RetryOptions: &RetryOptions{
+			Retryable:      true,
+			RetryCondition: []*RetryCondition{{MaxAttempts: 3, Exception: []string{"AErr"}}},
+		},
+	}
+	// every attempt builds a new request with the body the call was given
+	for _, test := range []struct {
+		body io.Reader
+		want string
+	}{
+		{strings.NewReader("payload"), "payload"},
+		{&readerAtOnly{reader: strings.NewReader("payload")}, "payload"},
+		{&chunkReader{data: "payload", chunk: 1}, "payload"},
+		{&chunkReader{data: "spooled payload", chunk: 1}, "spooled payload"},
+	} {
+		received = nil
+		failures = 2
+		var last *Request
+		callWithRetries(t, runtime, func() *Request {
+			last = NewRequest()
+			last.Method = String("POST")
+			last.Body = test.body
+			return last
+		})
+		utils.AssertEqual(t, []string{test.want, test.want, test.want}, received)
+		utils.AssertNil(t, last.Close())
+	}
+
+	// a spool moves to the next attempt, the one of a body not sent again is released
+	body := &chunkReader{data: "spooled payload", chunk: 1}
+	first := NewRequest()
+	first.Method = String("POST")
+	first.Body = body
+	_, err := DoRequest(first, runtime)
+	utils.AssertNil(t, err)
+	spooled := first.spool
+	second := NewRequest()
+	second.Method = String("POST")
+	second.Body = body
+	second.SetRetryPolicyContext(&RetryPolicyContext{RetriesAttempted: 1, HttpRequest: first})
+	utils.AssertNil(t, first.Close())
+	_, err = spooled.Stat()
+	utils.AssertNil(t, err)
+	third := NewRequest()
+	third.Body = strings.NewReader("other")
+	third.SetRetryPolicyContext(&RetryPolicyContext{RetriesAttempted: 2, HttpRequest: second})
+	_, err = spooled.Stat()
+	utils.AssertNotNil(t, err)
+}
+
+func Test_DoRequestSendsPipeBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		byt, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %s", r.TransferEncoding, byt)
+	}))
+	defer server.Close()
+	reader, writer, err := os.Pipe()
+	utils.AssertNil(t, err)
+	defer reader.Close()
+	go func() {
+		writer.Write([]byte("hello pipe"))
+		writer.Close()
+	}()
+
+	request := NewRequest()
+	request.Method = String("PUT")
+	request.Headers["host"] = String(strings.TrimPrefix(server.URL, "http://"))
+	request.Body = reader
+	response, err := DoRequest(request, nil)
+	utils.AssertNil(t, err)
+	byt, err := response.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "[chunked] hello pipe", string(byt))
+}
+
+func Test_sameReader(t *testing.T) {
+	reader := strings.NewReader("")
+	utils.AssertEqual(t, true, sameReader(reader, reader))
+	utils.AssertEqual(t, false, sameReader(reader, strings.NewReader("")))
+	utils.AssertEqual(t, false, sameReader(nil, reader))
+	utils.AssertEqual(t, false, sameReader(sliceReader{}, sliceReader{}))
+}
+
+type sliceReader []byte
+
+func (sliceReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func Test_bodyLength(t *testing.T) {
+	utils.AssertEqual(t, int64(6), bodyLength(bytes.NewBufferString("buffer")))
+	utils.AssertEqual(t, int64(5), bodyLength(bytes.NewReader([]byte("bytes"))))
+	reader := strings.NewReader("string")
+	reader.Seek(2, io.SeekStart)
+	utils.AssertEqual(t, int64(4), bodyLength(reader))
+	utils.AssertEqual(t, int64(-1), bodyLength(&chunkReader{data: "stream", chunk: 1}))
+
+	tempDir, err := ioutil.TempDir("", "body")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "body")
+	utils.AssertNil(t, ioutil.WriteFile(path, []byte("file content"), 0644))
+	file, err := os.Open(path)
+	utils.AssertNil(t, err)
+	defer file.Close()
+	file.Seek(5, io.SeekStart)
+	utils.AssertEqual(t, int64(7), bodyLength(file))
+
+	daraFile := NewDaraFile(path)
+	defer daraFile.Close()
+	section, err := daraFile.Body()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int64(12), bodyLength(section))
+
+	form := ToFileForm(map[string]interface{}{
+		"key": "value",
+		"file": &FileField{
+			Filename:    String("body"),
+			ContentType: String("text/plain"),
+			Content:     strings.NewReader("file content"),
+		},
+	}, "boundary")
+	length := bodyLength(form)
+	byt, err := ioutil.ReadAll(form)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int64(len(byt)), length)
+	utils.AssertEqual(t, int64(0), bodyLength(form))
+
+	form = ToFileForm(map[string]interface{}{
+		"file": &FileField{
+			Filename:    String("body"),
+			ContentType: String("text/plain"),
+			Content:     &chunkReader{data: "stream", chunk: 1},
+		},
+	}, "boundary")
+	utils.AssertEqual(t, int64(-1), bodyLength(form))
+}
+
+func Test_DoRequestSetsContentLength(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var lengths []int64
+	var bodies []string
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			lengths = append(lengths, req.ContentLength)
+			byt, _ := ioutil.ReadAll(req.Body)
+			bodies = append(bodies, string(byt))
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+
+	tempDir, err := ioutil.TempDir("", "body")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "body")
+	utils.AssertNil(t, ioutil.WriteFile(path, []byte("file content"), 0644))
+	daraFile := NewDaraFile(path)
+	defer daraFile.Close()
+	section, err := daraFile.Body()
+	utils.AssertNil(t, err)
+
+	listener := &recordListener{}
+	request := NewRequest()
+	request.Method = String("PUT")
+	request.Body = section
+	_, err = DoRequest(request, &RuntimeObject{Listener: listener})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int64(12), listener.events[0].TotalBytes)
+
+	request.Body = &chunkReader{data: "stream", chunk: 1}
+	request.Headers["content-length"] = String("6")
+	_, err = DoRequest(request, nil)
+	utils.AssertNil(t, err)
+
+	delete(request.Headers, "content-length")
+	request.Body = &chunkReader{data: "chunked", chunk: 1}
+	_, err = DoRequest(request, nil)
+	utils.AssertNil(t, err)
+
+	request.Body = strings.NewReader("")
+	_, err = DoRequest(request, nil)
+	utils.AssertNil(t, err)
+
+	// a length of 0 with a body other than http.NoBody is sent chunked
+	utils.AssertEqual(t, []int64{12, 6, 0, 0}, lengths)
+	utils.AssertEqual(t, []string{"file content", "stream", "chunked", ""}, bodies)
+}
+
+func Test_DoRequestContentLengthOnTheWire(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		byt, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%d %v %s", r.ContentLength, r.TransferEncoding, byt)
+	}))
+	defer server.Close()
+	send := func(body io.Reader) string {
+		request := NewRequest()
+		request.Method = String("PUT")
+		request.Headers["host"] = String(strings.TrimPrefix(server.URL, "http://"))
+		request.Body = body
+		response, err := DoRequest(request, nil)
+		utils.AssertNil(t, err)
+		byt, err := response.ReadBody()
+		utils.AssertNil(t, err)
+		return string(byt)
+	}
+
+	// the length of an io.ReaderAt is unknown, it is sent chunked
+	utils.AssertEqual(t, "-1 [chunked] reader at", send(&readerAtOnly{reader: strings.NewReader("reader at")}))
+	utils.AssertEqual(t, "6 [] string", send(strings.NewReader("string")))
+	utils.AssertEqual(t, "7 [] section", send(io.NewSectionReader(strings.NewReader("section"), 0, 7)))
+}
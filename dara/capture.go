@@ -0,0 +1,85 @@
+package dara
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+const truncatedSuffix = "...(truncated)"
+
+// bodyCapture keeps at most limit bytes of a body for logging
+type bodyCapture struct {
+	sync.Mutex
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func newBodyCapture(limit int) *bodyCapture {
+	return &bodyCapture{limit: limit}
+}
+
+func (capture *bodyCapture) Write(p []byte) (int, error) {
+	capture.Lock()
+	defer capture.Unlock()
+	remain := capture.limit - capture.buf.Len()
+	if remain <= 0 {
+		if len(p) > 0 {
+			capture.truncated = true
+		}
+		return len(p), nil
+	}
+	if len(p) > remain {
+		capture.buf.Write(p[:remain])
+		capture.truncated = true
+		return len(p), nil
+	}
+	capture.buf.Write(p)
+	return len(p), nil
+}
+
+// String returns the captured bytes with the redact keys masked
+func (capture *bodyCapture) String(redactKeys []string) string {
+	capture.Lock()
+	defer capture.Unlock()
+	str := utils.RedactBody(capture.buf.String(), redactKeys)
+	if capture.truncated {
+		str += truncatedSuffix
+	}
+	return str
+}
+
+// captureReadCloser copies what is read from a body into capture. done, when
+// set, is called once the body is read to its end or closed.
+type captureReadCloser struct {
+	io.ReadCloser
+	capture *bodyCapture
+	done    func()
+	once    sync.Once
+}
+
+func (reader *captureReadCloser) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	if n > 0 {
+		reader.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		reader.finish()
+	}
+	return
+}
+
+func (reader *captureReadCloser) Close() error {
+	err := reader.ReadCloser.Close()
+	reader.finish()
+	return err
+}
+
+func (reader *captureReadCloser) finish() {
+	if reader.done != nil {
+		reader.once.Do(reader.done)
+	}
+}
@@ -0,0 +1,150 @@
+package dara
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_bodyCapture(t *testing.T) {
+	capture := newBodyCapture(5)
+	n, err := capture.Write([]byte("abc"))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 3, n)
+	utils.AssertEqual(t, "abc", capture.String(nil))
+
+	n, err = capture.Write([]byte("defg"))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 4, n)
+	utils.AssertEqual(t, "abcde"+truncatedSuffix, capture.String(nil))
+
+	capture = newBodyCapture(64)
+	capture.Write([]byte(`{"Signature":"abc"}`))
+	utils.AssertEqual(t, `{"Signature":"******"}`, capture.String(utils.DefaultRedactKeys))
+}
+
+func Test_captureReadCloser(t *testing.T) {
+	capture := newBodyCapture(4)
+	done := 0
+	body := &captureReadCloser{ReadCloser: ioutil.NopCloser(strings.NewReader("tea body")), capture: capture,
+		done: func() { done++ }}
+	byt, err := ioutil.ReadAll(body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "tea body", string(byt))
+	utils.AssertEqual(t, "tea "+truncatedSuffix, capture.String(nil))
+	utils.AssertEqual(t, 1, done)
+	utils.AssertNil(t, body.Close())
+	utils.AssertEqual(t, 1, done)
+
+	// closing before the end reports what was read
+	capture = newBodyCapture(64)
+	body = &captureReadCloser{ReadCloser: ioutil.NopCloser(strings.NewReader("short body")), capture: capture,
+		done: func() { done++ }}
+	body.Read(make([]byte, 5))
+	utils.AssertNil(t, body.Close())
+	utils.AssertEqual(t, "short", capture.String(nil))
+	utils.AssertEqual(t, 2, done)
+}
+
+func Test_DoRequestWithBodyCapture(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			byt, err := ioutil.ReadAll(req.Body)
+			utils.AssertNil(t, err)
+			utils.AssertEqual(t, "Action=Test&Signature=abc", string(byt))
+			utils.AssertEqual(t, int64(25), req.ContentLength)
+			res, err := mockResponse(200, `{"RequestId":"id","SecurityToken":"token"}`, nil)
+			res.Header.Set("Content-Type", "application/json")
+			return res, err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	logger := utils.NewLogger("info", "", buf, "{req_headers} {req_body} {res_body}")
+	logger.SetBodyLimit(1024)
+	request := NewRequest()
+	request.Headers["content-type"] = String("application/x-www-form-urlencoded")
+	request.Headers["Authorization"] = String("acs ak:sign")
+	request.Body = strings.NewReader("Action=Test&Signature=abc")
+	resp, err := DoRequest(request, &RuntimeObject{Logger: logger})
+	utils.AssertNil(t, err)
+	byt, err := ioutil.ReadAll(resp.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"RequestId":"id","SecurityToken":"token"}`, string(byt))
+	utils.AssertContains(t, logger.GetLastLogMsg(), `"Authorization":["******"]`,
+		`Action=Test&Signature=******`, `{"RequestId":"id","SecurityToken":"******"}`)
+
+	// binary bodies are skipped
+	request.Headers["content-type"] = String("application/octet-stream")
+	request.Body = strings.NewReader("Action=Test&Signature=abc")
+	resp, err = DoRequest(request, &RuntimeObject{Logger: logger})
+	utils.AssertNil(t, err)
+	// the log of a captured response is printed once its body is closed
+	utils.AssertNil(t, resp.Body.Close())
+	utils.AssertEqual(t, false, strings.Contains(logger.GetLastLogMsg(), "Action=Test"))
+
+	// capturing is opt-in
+	logger.SetBodyLimit(0)
+	request.Headers["content-type"] = String("application/x-www-form-urlencoded")
+	request.Body = strings.NewReader("Action=Test&Signature=abc")
+	_, err = DoRequest(request, &RuntimeObject{Logger: logger})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, false, strings.Contains(logger.GetLastLogMsg(), "RequestId"))
+}
+
+func Test_DoRequestLogRedactsQuery(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return mockResponse(200, ``, nil)
+		}
+	}
+
+	logger := utils.NewLogger("info", "", new(bytes.Buffer), "{uri} {target}")
+	request := NewRequest()
+	request.Pathname = String("/")
+	request.Query["Action"] = String("Test")
+	request.Query["AccessKeyId"] = String("ak")
+	request.Query["Signature"] = String("abc")
+	_, err := DoRequest(request, &RuntimeObject{Logger: logger})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "/?AccessKeyId=******&Action=Test&Signature=****** /AccessKeyId=******&Action=Test&Signature=******",
+		logger.GetLastLogMsg())
+}
+
+func Test_DoRequestCapturesStreamedResponse(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	reader, writer := io.Pipe()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", "application/json")
+			return &http.Response{StatusCode: 200, Header: header, Body: reader}, nil
+		}
+	}
+
+	logger := utils.NewLogger("info", "", new(bytes.Buffer), "{code} {res_body}")
+	logger.SetBodyLimit(1024)
+	// DoRequest returns before the body is written
+	resp, err := DoRequest(NewRequest(), &RuntimeObject{Logger: logger})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "", logger.GetLastLogMsg())
+	go func() {
+		writer.Write([]byte(`{"a":1}`))
+		writer.Write([]byte(`{"SecurityToken":"token"}`))
+		writer.Close()
+	}()
+	byt, err := ioutil.ReadAll(resp.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"a":1}{"SecurityToken":"token"}`, string(byt))
+	utils.AssertEqual(t, `200 {"a":1}{"SecurityToken":"******"}`, logger.GetLastLogMsg())
+}
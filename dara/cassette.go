@@ -0,0 +1,298 @@
+package dara
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultCassetteOptions filters the volatile signature fields of Alibaba Cloud requests
+var DefaultCassetteOptions = &CassetteOptions{
+	FilterQuery: []string{"Signature", "SignatureNonce", "Timestamp", "AccessKeyId", "SecurityToken"},
+	FilterHeaders: []string{"Authorization", "Date", "X-Acs-Date", "X-Acs-Signature-Nonce",
+		"X-Acs-Content-Sha256", "X-Acs-Security-Token", "X-Acs-Accesskey-Id", "User-Agent"},
+}
+
+// CassetteOptions controls how interactions are recorded and matched
+type CassetteOptions struct {
+	// MatchHeaders lists the request headers compared when replaying
+	MatchHeaders []string
+	// FilterQuery lists the query keys dropped from recordings and matching
+	FilterQuery []string
+	// FilterHeaders lists the headers dropped from recordings
+	FilterHeaders []string
+}
+
+// Cassette is the file format of recorded interactions
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request/response pair
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the request side of an interaction
+type RecordedRequest struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+}
+
+// RecordedResponse is the response side of an interaction
+type RecordedResponse struct {
+	StatusCode   int                 `json:"statusCode"`
+	Status       string              `json:"status"`
+	Headers      map[string][]string `json:"headers,omitempty"`
+	Body         string              `json:"body,omitempty"`
+	BodyEncoding string              `json:"bodyEncoding,omitempty"`
+}
+
+// RecordingClient is a HttpClient which saves every interaction of client to a cassette file
+type RecordingClient struct {
+	sync.Mutex
+	path     string
+	client   HttpClient
+	options  *CassetteOptions
+	cassette *Cassette
+}
+
+// ReplayingClient is a HttpClient which serves responses from a cassette file
+type ReplayingClient struct {
+	sync.Mutex
+	options  *CassetteOptions
+	cassette *Cassette
+	used     []bool
+}
+
+// NewRecordingClient records the calls made through client into the cassette at
+// path. The pooled client of the RuntimeObject is used when client is nil.
+func NewRecordingClient(path string, client HttpClient, options *CassetteOptions) *RecordingClient {
+	if options == nil {
+		options = DefaultCassetteOptions
+	}
+	return &RecordingClient{
+		path:     path,
+		client:   client,
+		options:  options,
+		cassette: &Cassette{Interactions: make([]*Interaction, 0)},
+	}
+}
+
+func (recorder *RecordingClient) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	reqBody, err := drainBody(&request.Body)
+	if err != nil {
+		return nil, err
+	}
+	client := recorder.client
+	if client == nil {
+		client = defaultClientOf(request, transport)
+	}
+	response, err := client.Call(request, transport)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := drainBody(&response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: &RecordedRequest{
+			Method:  request.Method,
+			Path:    request.URL.Path,
+			Query:   filterValues(request.URL.Query(), recorder.options.FilterQuery),
+			Headers: filterValues(request.Header, recorder.options.FilterHeaders),
+			Body:    string(reqBody),
+		},
+		Response: &RecordedResponse{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Headers:    response.Header,
+		},
+	}
+	if utf8.Valid(resBody) {
+		interaction.Response.Body = string(resBody)
+	} else {
+		interaction.Response.Body = base64.StdEncoding.EncodeToString(resBody)
+		interaction.Response.BodyEncoding = "base64"
+	}
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.cassette.Interactions = append(recorder.cassette.Interactions, interaction)
+	byt, err := json.MarshalIndent(recorder.cassette, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(recorder.path, byt, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// NewReplayingClient loads the cassette at path
+func NewReplayingClient(path string, options *CassetteOptions) (*ReplayingClient, error) {
+	if options == nil {
+		options = DefaultCassetteOptions
+	}
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := new(Cassette)
+	err = json.Unmarshal(byt, cassette)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayingClient{
+		options:  options,
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}, nil
+}
+
+// Call returns the first unused interaction matching request, falling back to
+// an already used one so repeated identical calls keep working.
+func (replayer *ReplayingClient) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	query := canonicalValues(filterValues(request.URL.Query(), replayer.options.FilterQuery))
+	replayer.Lock()
+	defer replayer.Unlock()
+	matched := -1
+	for i, interaction := range replayer.cassette.Interactions {
+		recorded := interaction.Request
+		if recorded.Method != request.Method || recorded.Path != request.URL.Path ||
+			canonicalValues(filterValues(recorded.Query, replayer.options.FilterQuery)) != query ||
+			!replayer.matchHeaders(recorded.Headers, request.Header) {
+			continue
+		}
+		if !replayer.used[i] {
+			matched = i
+			break
+		}
+		if matched == -1 {
+			matched = i
+		}
+	}
+	if matched == -1 {
+		return nil, fmt.Errorf("dara: no recorded interaction matches %s %s", request.Method, request.URL.RequestURI())
+	}
+	replayer.used[matched] = true
+	if request.Body != nil {
+		request.Body.Close()
+	}
+
+	recorded := replayer.cassette.Interactions[matched].Response
+	body := []byte(recorded.Body)
+	if recorded.BodyEncoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(recorded.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	header := http.Header{}
+	for key, values := range recorded.Headers {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    recorded.StatusCode,
+		Status:        recorded.Status,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+func (replayer *ReplayingClient) matchHeaders(recorded map[string][]string, header http.Header) bool {
+	for _, name := range replayer.options.MatchHeaders {
+		if strings.Join(foldValues(recorded, name), ",") != strings.Join(foldValues(header, name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// foldValues returns the values of key in values ignoring case
+func foldValues(values map[string][]string, key string) []string {
+	var result []string
+	for name, value := range values {
+		if strings.EqualFold(name, key) {
+			result = append(result, value...)
+		}
+	}
+	return result
+}
+
+// drainBody reads body fully and replaces it with an in-memory copy
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	byt, err := ioutil.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(byt))
+	return byt, nil
+}
+
+func filterValues(values map[string][]string, filters []string) map[string][]string {
+	result := make(map[string][]string)
+	for key, value := range values {
+		if isFilterKey(key, filters) {
+			continue
+		}
+		result[key] = value
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func isFilterKey(key string, filters []string) bool {
+	for _, filter := range filters {
+		if strings.EqualFold(key, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalValues encodes values sorted by key and value
+func canonicalValues(values map[string][]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		sorted := append([]string(nil), values[key]...)
+		sort.Strings(sorted)
+		for _, value := range sorted {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,156 @@
+package dara
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+type stubClient struct {
+	calls   int
+	handler func(req *http.Request) (*http.Response, error)
+}
+
+func (client *stubClient) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	client.calls++
+	return client.handler(request)
+}
+
+func Test_RecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	stub := &stubClient{
+		handler: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("Action") == "Download" {
+				return mockResponse(200, "\xff\xfe\x00", nil)
+			}
+			byt, _ := ioutil.ReadAll(req.Body)
+			return mockResponse(200, `{"body":"`+string(byt)+`"}`, nil)
+		},
+	}
+	recorder := NewRecordingClient(path, stub, nil)
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Pathname = String("/api")
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Headers["x-acs-action"] = String("Describe")
+	request.Query["Action"] = String("Describe")
+	request.Query["Signature"] = String("first")
+	request.Query["Timestamp"] = String("2024-01-01T00:00:00Z")
+	request.Body = strings.NewReader("payload")
+	resp, err := DoRequest(request, &RuntimeObject{HttpClient: recorder})
+	utils.AssertNil(t, err)
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"body":"payload"}`, string(body))
+
+	request.Query["Action"] = String("Download")
+	request.Body = nil
+	resp, err = DoRequest(request, &RuntimeObject{HttpClient: recorder})
+	utils.AssertNil(t, err)
+	body, err = resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, []byte("\xff\xfe\x00"), body)
+	utils.AssertEqual(t, 2, stub.calls)
+
+	byt, err := ioutil.ReadFile(path)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, false, bytes.Contains(byt, []byte("first")))
+	utils.AssertContains(t, string(byt), `"bodyEncoding": "base64"`)
+
+	replayer, err := NewReplayingClient(path, &CassetteOptions{
+		MatchHeaders: []string{"x-acs-action"},
+		FilterQuery:  DefaultCassetteOptions.FilterQuery,
+	})
+	utils.AssertNil(t, err)
+	request.Query["Action"] = String("Describe")
+	request.Query["Signature"] = String("second")
+	request.Query["Timestamp"] = String("2024-02-01T00:00:00Z")
+	request.Body = strings.NewReader("payload")
+	for i := 0; i < 2; i++ {
+		resp, err = DoRequest(request, &RuntimeObject{HttpClient: replayer})
+		utils.AssertNil(t, err)
+		body, err = resp.ReadBody()
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, `{"body":"payload"}`, string(body))
+		utils.AssertEqual(t, "test", StringValue(resp.Headers["tea"]))
+	}
+
+	request.Query["Action"] = String("Download")
+	resp, err = DoRequest(request, &RuntimeObject{HttpClient: replayer})
+	utils.AssertNil(t, err)
+	body, err = resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, []byte("\xff\xfe\x00"), body)
+
+	request.Headers["x-acs-action"] = String("Other")
+	_, err = DoRequest(request, &RuntimeObject{HttpClient: replayer})
+	utils.AssertContains(t, err.Error(), "no recorded interaction matches POST /api?Action=Download")
+	utils.AssertEqual(t, 2, stub.calls)
+
+	_, err = NewReplayingClient(filepath.Join(dir, "missing.json"), nil)
+	utils.AssertNotNil(t, err)
+}
+
+func Test_RecordingClientUsesRuntimeSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "tea"})
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+		cookie, _ := r.Cookie("session")
+		if cookie != nil {
+			w.Write([]byte(cookie.Value))
+		}
+	}))
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	utils.AssertNil(t, err)
+	recorder := NewRecordingClient(filepath.Join(dir, "cassette.json"), nil, nil)
+	runtime := &RuntimeObject{HttpClient: recorder, CookieJar: jar, ReadTimeout: Int(100)}
+	send := func(pathname string) (string, error) {
+		request := NewRequest()
+		request.Pathname = String(pathname)
+		request.Headers["host"] = String(strings.TrimPrefix(server.URL, "http://"))
+		resp, err := DoRequest(request, runtime)
+		if err != nil {
+			return "", err
+		}
+		body, err := resp.ReadBody()
+		return string(body), err
+	}
+	_, err = send("/login")
+	utils.AssertNil(t, err)
+	body, err := send("/")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "tea", body)
+	_, err = send("/slow")
+	utils.AssertContains(t, err.Error(), "Client.Timeout")
+}
+
+func Test_canonicalValues(t *testing.T) {
+	values := map[string][]string{
+		"b": []string{"2", "1"},
+		"a": []string{"x y"},
+	}
+	utils.AssertEqual(t, "a=x+y&b=1&b=2", canonicalValues(values))
+	utils.AssertNil(t, filterValues(map[string][]string{"Signature": []string{"s"}}, []string{"signature"}))
+}
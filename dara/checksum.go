@@ -0,0 +1,267 @@
+package dara
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ChecksumMD5 verifies data with MD5
+	ChecksumMD5 = "md5"
+	// ChecksumCRC64 verifies data with CRC-64/ECMA
+	ChecksumCRC64 = "crc64"
+	// ChecksumSHA256 verifies data with SHA-256
+	ChecksumSHA256 = "sha256"
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// newChecksumHash returns the hash of algorithm
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumCRC64:
+		return crc64.New(crc64Table), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("dara: unsupported checksum algorithm %q", algorithm)
+}
+
+// checksumMatches reports whether sum equals expected written in hex, base64
+// or, for CRC-64, decimal as returned by the x-oss-hash-crc64ecma header.
+func checksumMatches(sum []byte, expected string) bool {
+	expected = strings.Trim(strings.TrimSpace(expected), `"`)
+	if strings.EqualFold(hex.EncodeToString(sum), expected) {
+		return true
+	}
+	if base64.StdEncoding.EncodeToString(sum) == expected {
+		return true
+	}
+	if len(sum) == 8 {
+		return strconv.FormatUint(binary.BigEndian.Uint64(sum), 10) == expected
+	}
+	return false
+}
+
+// IntegrityError is returned when the checksum of a body differs from the expected one
+type IntegrityError struct {
+	Algorithm string
+	// Header is the header which held Expected, empty when it was given directly
+	Header   string
+	Expected string
+	Actual   string
+}
+
+func (err *IntegrityError) Error() string {
+	source := "expected"
+	if err.Header != "" {
+		source = err.Header
+	}
+	return fmt.Sprintf("dara: %s checksum %s does not match %s %s", err.Algorithm, err.Actual, source, err.Expected)
+}
+
+// GetName returns the name used by retry conditions
+func (err *IntegrityError) GetName() *string {
+	return String("IntegrityError")
+}
+
+// GetCode returns the code used by retry conditions
+func (err *IntegrityError) GetCode() *string {
+	return String("InconsistentChecksum")
+}
+
+// ChecksumReader computes the checksum of the data read through it and
+// compares it with the expected value at EOF.
+type ChecksumReader struct {
+	reader    io.Reader
+	hash      hash.Hash
+	algorithm string
+	header    string
+	expected  string
+	err       error
+}
+
+// NewChecksumReader wraps reader, an empty expected only computes the checksum
+func NewChecksumReader(reader io.Reader, algorithm, expected string) (*ChecksumReader, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumReader{
+		reader:    reader,
+		hash:      h,
+		algorithm: strings.ToLower(algorithm),
+		expected:  expected,
+	}, nil
+}
+
+func (reader *ChecksumReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	n, err := reader.reader.Read(p)
+	reader.hash.Write(p[:n])
+	if err == io.EOF && reader.expected != "" {
+		if sum := reader.hash.Sum(nil); !checksumMatches(sum, reader.expected) {
+			err = &IntegrityError{
+				Algorithm: reader.algorithm,
+				Header:    reader.header,
+				Expected:  reader.expected,
+				Actual:    formatChecksum(reader.algorithm, sum),
+			}
+		}
+	}
+	if err != nil {
+		reader.err = err
+	}
+	return n, err
+}
+
+// Close closes the wrapped reader when it is an io.Closer
+func (reader *ChecksumReader) Close() error {
+	if closer, ok := reader.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Sum returns the checksum of the data read so far
+func (reader *ChecksumReader) Sum() []byte {
+	return reader.hash.Sum(nil)
+}
+
+// ChecksumWriter computes the checksum of the data written through it
+type ChecksumWriter struct {
+	writer    io.Writer
+	hash      hash.Hash
+	algorithm string
+}
+
+// NewChecksumWriter wraps writer
+func NewChecksumWriter(writer io.Writer, algorithm string) (*ChecksumWriter, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumWriter{
+		writer:    writer,
+		hash:      h,
+		algorithm: strings.ToLower(algorithm),
+	}, nil
+}
+
+func (writer *ChecksumWriter) Write(p []byte) (int, error) {
+	n, err := writer.writer.Write(p)
+	writer.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the checksum of the data written so far
+func (writer *ChecksumWriter) Sum() []byte {
+	return writer.hash.Sum(nil)
+}
+
+// Verify compares the checksum of the data written with expected
+func (writer *ChecksumWriter) Verify(expected string) error {
+	sum := writer.hash.Sum(nil)
+	if checksumMatches(sum, expected) {
+		return nil
+	}
+	return &IntegrityError{
+		Algorithm: writer.algorithm,
+		Expected:  expected,
+		Actual:    formatChecksum(writer.algorithm, sum),
+	}
+}
+
+// VerifyResponseChecksum wraps the body of response so that reading it to the
+// end returns an *IntegrityError when its checksum differs from header. The
+// body is left as is when the response has no such header. The checksum of a
+// decompressed body is computed on the bytes received, so it must be verified
+// before the body is read.
+func VerifyResponseChecksum(response *Response, algorithm, header string) error {
+	expected := StringValue(response.Headers[strings.ToLower(header)])
+	if expected == "" || response.Body == nil {
+		return nil
+	}
+	decompressing := response.decoder
+	if decompressing == nil {
+		decompressing, _ = response.Body.(*decompressingReader)
+	}
+	if decompressing != nil {
+		// header describes the encoded body, which decoding has consumed once started
+		if decompressing.decoder != nil || decompressing.err != nil {
+			return fmt.Errorf("dara: the %s checksum of a decompressed body must be verified before the body is read", algorithm)
+		}
+		reader, err := NewChecksumReader(decompressing.source, algorithm, expected)
+		if err != nil {
+			return err
+		}
+		reader.header = header
+		decompressing.source = reader
+		return nil
+	}
+	reader, err := NewChecksumReader(response.Body, algorithm, expected)
+	if err != nil {
+		return err
+	}
+	reader.header = header
+	response.setBody(reader)
+	return nil
+}
+
+// SetRequestChecksum computes the checksum of the body of request and puts it
+// into header: CRC-64 as a decimal, MD5 in base64 like Content-MD5 and SHA-256
+// in hex like x-acs-content-sha256. Seekable bodies are rewound, others are
+// buffered in memory.
+func SetRequestChecksum(request *Request, algorithm, header string) error {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return err
+	}
+	if seeker, ok := request.Body.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(h, request.Body); err != nil {
+			return err
+		}
+		if _, err = seeker.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		byt, err := readBodyBytes(request)
+		if err != nil {
+			return err
+		}
+		h.Write(byt)
+	}
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	request.Headers[strings.ToLower(header)] = String(formatChecksum(algorithm, h.Sum(nil)))
+	return nil
+}
+
+// formatChecksum encodes sum the way services send the checksum of algorithm
+func formatChecksum(algorithm string, sum []byte) string {
+	switch strings.ToLower(algorithm) {
+	case ChecksumCRC64:
+		return strconv.FormatUint(binary.BigEndian.Uint64(sum), 10)
+	case ChecksumMD5:
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
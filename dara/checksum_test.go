@@ -0,0 +1,119 @@
+package dara
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc64"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_checksumMatches(t *testing.T) {
+	sum := crc64.Checksum([]byte("hello"), crc64Table)
+	hash, _ := newChecksumHash(ChecksumCRC64)
+	hash.Write([]byte("hello"))
+	utils.AssertEqual(t, true, checksumMatches(hash.Sum(nil), strconv.FormatUint(sum, 10)))
+	utils.AssertEqual(t, true, checksumMatches(hash.Sum(nil), fmt.Sprintf("%016X", sum)))
+	md5Sum := md5.Sum([]byte("hello"))
+	utils.AssertEqual(t, true, checksumMatches(md5Sum[:], "XUFAKrxLKna5cZ2REBfFkg=="))
+	utils.AssertEqual(t, true, checksumMatches(md5Sum[:], `"5d41402abc4b2a76b9719d911017c592"`))
+	utils.AssertEqual(t, false, checksumMatches(md5Sum[:], "5d41402abc4b2a76b9719d911017c593"))
+}
+
+func Test_ChecksumReader(t *testing.T) {
+	crc := strconv.FormatUint(crc64.Checksum([]byte("hello world"), crc64Table), 10)
+	reader, err := NewChecksumReader(strings.NewReader("hello world"), ChecksumCRC64, crc)
+	utils.AssertNil(t, err)
+	byt, err := ioutil.ReadAll(reader)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "hello world", string(byt))
+	utils.AssertEqual(t, crc, formatChecksum(ChecksumCRC64, reader.Sum()))
+
+	reader, err = NewChecksumReader(strings.NewReader("hello world"), ChecksumCRC64, "12345")
+	utils.AssertNil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	integrityErr, ok := err.(*IntegrityError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, crc, integrityErr.Actual)
+	utils.AssertEqual(t, "dara: crc64 checksum "+crc+" does not match expected 12345", err.Error())
+	utils.AssertEqual(t, "IntegrityError", StringValue(integrityErr.GetName()))
+	utils.AssertEqual(t, "InconsistentChecksum", StringValue(integrityErr.GetCode()))
+	// the error is sticky
+	_, err = reader.Read(make([]byte, 1))
+	utils.AssertEqual(t, integrityErr, err)
+
+	_, err = NewChecksumReader(strings.NewReader(""), "sha1", "")
+	utils.AssertEqual(t, `dara: unsupported checksum algorithm "sha1"`, err.Error())
+}
+
+func Test_ChecksumWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewChecksumWriter(&buf, ChecksumSHA256)
+	utils.AssertNil(t, err)
+	writer.Write([]byte("hello "))
+	writer.Write([]byte("world"))
+	sum := sha256.Sum256([]byte("hello world"))
+	utils.AssertEqual(t, "hello world", buf.String())
+	utils.AssertEqual(t, hex.EncodeToString(sum[:]), hex.EncodeToString(writer.Sum()))
+	utils.AssertNil(t, writer.Verify(hex.EncodeToString(sum[:])))
+	err = writer.Verify("abc")
+	utils.AssertEqual(t, "dara: sha256 checksum "+hex.EncodeToString(sum[:])+" does not match expected abc", err.Error())
+}
+
+func Test_VerifyResponseChecksum(t *testing.T) {
+	md5Sum := md5.Sum([]byte("body"))
+	response := &Response{
+		Body:    ioutil.NopCloser(strings.NewReader("body")),
+		Headers: map[string]*string{"content-md5": String("invalid")},
+	}
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+	_, err := response.ReadBody()
+	utils.AssertEqual(t, "dara: md5 checksum "+formatChecksum(ChecksumMD5, md5Sum[:])+" does not match Content-MD5 invalid", err.Error())
+
+	response = &Response{
+		Body:    ioutil.NopCloser(strings.NewReader("body")),
+		Headers: map[string]*string{"content-md5": String(formatChecksum(ChecksumMD5, md5Sum[:]))},
+	}
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+	byt, err := response.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "body", string(byt))
+
+	// without the header the body is not verified
+	response = &Response{
+		Body:    ioutil.NopCloser(strings.NewReader("body")),
+		Headers: map[string]*string{},
+	}
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+	_, ok := response.Body.(*ChecksumReader)
+	utils.AssertEqual(t, false, ok)
+}
+
+func Test_SetRequestChecksum(t *testing.T) {
+	request := NewRequest()
+	request.Body = strings.NewReader("hello world")
+	request.Body.(*strings.Reader).Seek(6, 0)
+	utils.AssertNil(t, SetRequestChecksum(request, ChecksumCRC64, "x-oss-hash-crc64ecma"))
+	utils.AssertEqual(t, strconv.FormatUint(crc64.Checksum([]byte("world"), crc64Table), 10),
+		StringValue(request.Headers["x-oss-hash-crc64ecma"]))
+	byt, _ := ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, "world", string(byt))
+
+	request = &Request{Body: &chunkReader{data: "hello world", chunk: 3}}
+	utils.AssertNil(t, SetRequestChecksum(request, ChecksumMD5, "Content-MD5"))
+	utils.AssertEqual(t, "XrY7u+Ae7tCTyyK7j1rNww==", StringValue(request.Headers["content-md5"]))
+	byt, _ = ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, "hello world", string(byt))
+
+	request = &Request{Body: strings.NewReader("")}
+	utils.AssertNil(t, SetRequestChecksum(request, ChecksumSHA256, "x-acs-content-sha256"))
+	utils.AssertEqual(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		StringValue(request.Headers["x-acs-content-sha256"]))
+}
@@ -0,0 +1,128 @@
+package dara
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkewTolerance is the smallest clock offset kept, the Date header only has a precision of one second
+const clockSkewTolerance = 5 * time.Second
+
+// ClockSkewErrorCodes are the error codes after which a signed request is
+// sent again when the clock offset of the endpoint has changed
+var ClockSkewErrorCodes = []string{
+	"SignatureDoesNotMatch",
+	"InvalidTimeStamp.Expired",
+	"InvalidTimeStamp.Format",
+	"IllegalTimestamp",
+	"RequestTimeTooSkewed",
+}
+
+// clockOffsets maps endpoints to the time.Duration their clock is ahead of the local one
+var clockOffsets sync.Map
+
+// ClockOffset returns how far the clock of endpoint, a host with its port, is
+// ahead of the local clock, as seen in the Date header of its last response
+func ClockOffset(endpoint string) time.Duration {
+	if offset, ok := clockOffsets.Load(endpoint); ok {
+		return offset.(time.Duration)
+	}
+	return 0
+}
+
+// SetClockOffset sets the clock offset of endpoint
+func SetClockOffset(endpoint string, offset time.Duration) {
+	if offset > -clockSkewTolerance && offset < clockSkewTolerance {
+		clockOffsets.Delete(endpoint)
+		return
+	}
+	clockOffsets.Store(endpoint, offset)
+}
+
+// ServerTime returns the current time of endpoint
+func ServerTime(endpoint string) time.Time {
+	return time.Now().Add(ClockOffset(endpoint))
+}
+
+// ServerTimestamp returns the current time of endpoint in the
+// 2006-01-02T15:04:05Z format of the Timestamp and x-acs-date parameters
+func ServerTimestamp(endpoint string) string {
+	return ServerTime(endpoint).UTC().Format(iso8601Format)
+}
+
+// recordClockOffset updates the clock offset of endpoint from the Date header
+// of a response to a request sent at sent and received at received
+func recordClockOffset(endpoint, date string, sent, received time.Time) {
+	if endpoint == "" || date == "" {
+		return
+	}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	// the server truncated its time to the second somewhere between sent and received
+	local := sent.Add(received.Sub(sent) / 2)
+	SetClockOffset(endpoint, serverTime.Add(500*time.Millisecond).Sub(local))
+}
+
+// shouldRetryClockSkew reports whether response is an error caused by a skewed
+// clock which the new clock offset of the endpoint corrects. The body of
+// response stays readable.
+func shouldRetryClockSkew(request *Request, runtimeObject *RuntimeObject, response *Response, offset time.Duration) bool {
+	if runtimeObject.Signer == nil || BoolValue(runtimeObject.DisableClockSkewCorrection) ||
+		response.Body == nil || IntValue(response.StatusCode) < 400 || IntValue(response.StatusCode) >= 500 {
+		return false
+	}
+	if request.Body != nil && !sameReader(request.bodySource, request.Body) {
+		// the body was not kept, so it can not be sent again
+		return false
+	}
+	change := ClockOffset(StringValue(request.Domain)) - offset
+	if change > -clockSkewTolerance && change < clockSkewTolerance {
+		return false
+	}
+	byt, err := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+	response.setBody(&struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(byt), response.Body), response.Body})
+	if err != nil {
+		return false
+	}
+	code := errorCode(byt)
+	for _, skewCode := range ClockSkewErrorCodes {
+		if code == skewCode {
+			return true
+		}
+	}
+	return false
+}
+
+// errorCode returns the Code of a JSON or XML error body
+func errorCode(byt []byte) string {
+	var body map[string]interface{}
+	if err := json.Unmarshal(byt, &body); err == nil {
+		for _, key := range []string{"Code", "code"} {
+			if code, ok := body[key].(string); ok {
+				return code
+			}
+		}
+		return ""
+	}
+	text := string(byt)
+	start := strings.Index(text, "<Code>")
+	if start < 0 {
+		return ""
+	}
+	text = text[start+len("<Code>"):]
+	if end := strings.Index(text, "</Code>"); end >= 0 {
+		return strings.TrimSpace(text[:end])
+	}
+	return ""
+}
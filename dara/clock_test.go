@@ -0,0 +1,134 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_ClockOffset(t *testing.T) {
+	endpoint := "clock.example.com"
+	utils.AssertEqual(t, time.Duration(0), ClockOffset(endpoint))
+
+	now := time.Now()
+	recordClockOffset(endpoint, now.Add(time.Hour).UTC().Format(http.TimeFormat), now, now)
+	offset := ClockOffset(endpoint)
+	utils.AssertEqual(t, true, offset > time.Hour-time.Second && offset < time.Hour+time.Second)
+	serverTime := ServerTime(endpoint)
+	utils.AssertEqual(t, true, serverTime.Sub(time.Now().Add(time.Hour)) < 2*time.Second)
+	utils.AssertEqual(t, serverTime.UTC().Format(iso8601Format)[:13], ServerTimestamp(endpoint)[:13])
+
+	// small offsets and invalid dates are ignored
+	recordClockOffset(endpoint, "yesterday", now, now)
+	utils.AssertEqual(t, offset, ClockOffset(endpoint))
+	recordClockOffset(endpoint, now.Add(2*time.Second).UTC().Format(http.TimeFormat), now, now)
+	utils.AssertEqual(t, time.Duration(0), ClockOffset(endpoint))
+	SetClockOffset(endpoint, -time.Minute)
+	utils.AssertEqual(t, -time.Minute, ClockOffset(endpoint))
+	SetClockOffset(endpoint, 0)
+	utils.AssertEqual(t, time.Duration(0), ClockOffset(endpoint))
+}
+
+func Test_ErrorCode(t *testing.T) {
+	utils.AssertEqual(t, "InvalidTimeStamp.Expired", errorCode([]byte(`{"Code":"InvalidTimeStamp.Expired","Message":"expired"}`)))
+	utils.AssertEqual(t, "SignatureDoesNotMatch", errorCode([]byte(`{"code":"SignatureDoesNotMatch"}`)))
+	utils.AssertEqual(t, "RequestTimeTooSkewed", errorCode([]byte(`<?xml version="1.0"?><Error><Code> RequestTimeTooSkewed </Code></Error>`)))
+	utils.AssertEqual(t, "", errorCode([]byte(`{"Message":"none"}`)))
+	utils.AssertEqual(t, "", errorCode([]byte(`<Error><Code>open`)))
+	utils.AssertEqual(t, "", errorCode([]byte(`plain text`)))
+}
+
+// skewedServer accepts requests signed within a minute of its clock, which is
+// offset ahead of the local one
+type skewedServer struct {
+	offset  time.Duration
+	code    string
+	signed  []time.Time
+	bodies  []string
+	failing bool
+}
+
+func (server *skewedServer) hook(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+	return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		signed, _ := time.Parse(iso8601Format, req.URL.Query().Get("Timestamp"))
+		server.signed = append(server.signed, signed)
+		body := ""
+		if req.Body != nil {
+			byt, _ := ioutil.ReadAll(req.Body)
+			body = string(byt)
+		}
+		server.bodies = append(server.bodies, body)
+		now := time.Now().Add(server.offset)
+		header := http.Header{"Date": []string{now.UTC().Format(http.TimeFormat)}}
+		diff := now.Sub(signed)
+		if server.failing || diff > time.Minute || diff < -time.Minute {
+			return &http.Response{StatusCode: 400, Header: header,
+				Body: ioutil.NopCloser(strings.NewReader(`{"Code":"` + server.code + `","Message":"skewed"}`))}, nil
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	}
+}
+
+func newSkewedRequest(host string) *Request {
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Headers["host"] = String(host)
+	request.Query["Action"] = String("Describe")
+	request.Body = strings.NewReader("payload")
+	return request
+}
+
+func Test_DoRequestClockSkew(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	runtime := &RuntimeObject{Signer: &RPCSigner{Credential: &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}}}
+
+	server := &skewedServer{offset: time.Hour, code: "InvalidTimeStamp.Expired"}
+	hookDo = server.hook
+	response, err := DoRequest(newSkewedRequest("skew1.example.com"), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, IntValue(response.StatusCode))
+	utils.AssertEqual(t, 2, len(server.signed))
+	utils.AssertEqual(t, []string{"payload", "payload"}, server.bodies)
+	utils.AssertEqual(t, true, server.signed[1].Sub(server.signed[0]) > 59*time.Minute)
+
+	// the offset is kept for the endpoint
+	response, err = DoRequest(newSkewedRequest("skew1.example.com"), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, IntValue(response.StatusCode))
+	utils.AssertEqual(t, 3, len(server.signed))
+	utils.AssertEqual(t, true, ClockOffset("skew1.example.com") > 59*time.Minute)
+
+	// the request is sent again once only
+	server = &skewedServer{offset: -time.Hour, code: "SignatureDoesNotMatch", failing: true}
+	hookDo = server.hook
+	response, err = DoRequest(newSkewedRequest("skew2.example.com"), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 400, IntValue(response.StatusCode))
+	utils.AssertEqual(t, 2, len(server.signed))
+	byt, _ := response.ReadBody()
+	utils.AssertEqual(t, `{"Code":"SignatureDoesNotMatch","Message":"skewed"}`, string(byt))
+
+	// other errors are not retried, and their body stays readable
+	server = &skewedServer{offset: time.Hour, code: "Forbidden"}
+	hookDo = server.hook
+	response, err = DoRequest(newSkewedRequest("skew3.example.com"), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(server.signed))
+	byt, _ = response.ReadBody()
+	utils.AssertEqual(t, `{"Code":"Forbidden","Message":"skewed"}`, string(byt))
+
+	// nor requests without correction
+	server = &skewedServer{offset: time.Hour, code: "InvalidTimeStamp.Expired"}
+	hookDo = server.hook
+	runtime.DisableClockSkewCorrection = Bool(true)
+	response, err = DoRequest(newSkewedRequest("skew4.example.com"), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 400, IntValue(response.StatusCode))
+	utils.AssertEqual(t, 1, len(server.signed))
+	utils.AssertEqual(t, time.Duration(0), ClockOffset("skew4.example.com"))
+}
@@ -0,0 +1,196 @@
+package dara
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// EncodingGzip is the gzip content coding
+	EncodingGzip = "gzip"
+	// EncodingDeflate is the deflate content coding, a zlib stream
+	EncodingDeflate = "deflate"
+	// EncodingZstd is the zstd content coding
+	EncodingZstd = "zstd"
+)
+
+// DefaultCompressionThreshold is the smallest body compressed when RuntimeObject.RequestCompressionThreshold is not set
+const DefaultCompressionThreshold = 1024
+
+// maxCompressionBodySize is the largest request body compressed, larger ones
+// are sent as they are rather than held in memory
+var maxCompressionBodySize int64 = 32 * 1024 * 1024
+
+// CompressRequestBody compresses the body of request with encoding when it has
+// at least threshold bytes. The content-encoding and content-length headers are
+// set and a content-md5 header is computed again. Signatures over the body must
+// be calculated after it. Bodies which already have a content-encoding and
+// bodies larger than 32 MiB are left as is, only that much of a body of unknown
+// length is read to find out.
+func CompressRequestBody(request *Request, encoding string, threshold int) error {
+	encoding = strings.ToLower(encoding)
+	if encoding != EncodingGzip && encoding != EncodingDeflate && encoding != EncodingZstd {
+		return fmt.Errorf("dara: unsupported content encoding %q", encoding)
+	}
+	if request.Body == nil || getHeaderValue(request.Headers, "content-encoding") != "" {
+		return nil
+	}
+	if length := bodyLength(request.Body); length >= 0 && (length < int64(threshold) || length > maxCompressionBodySize) {
+		return nil
+	}
+	byt, complete, err := readBodyPrefix(request, maxCompressionBodySize)
+	if err != nil {
+		return err
+	}
+	if !complete || len(byt) < threshold {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		writer = gzip.NewWriter(&buf)
+	case EncodingDeflate:
+		writer = zlib.NewWriter(&buf)
+	case EncodingZstd:
+		writer, err = zstd.NewWriter(&buf)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = writer.Write(byt); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	request.Body = bytes.NewReader(buf.Bytes())
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	setHeaderValue(request.Headers, "content-encoding", encoding)
+	setHeaderValue(request.Headers, "content-length", strconv.Itoa(buf.Len()))
+	if getHeaderValue(request.Headers, "content-md5") != "" {
+		sum := md5.Sum(buf.Bytes())
+		setHeaderValue(request.Headers, "content-md5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return nil
+}
+
+// compressRequest compresses the body of request as runtimeObject says
+func compressRequest(request *Request, runtimeObject *RuntimeObject) error {
+	encoding := StringValue(runtimeObject.RequestCompression)
+	if encoding == "" {
+		return nil
+	}
+	threshold := DefaultCompressionThreshold
+	if runtimeObject.RequestCompressionThreshold != nil {
+		threshold = IntValue(runtimeObject.RequestCompressionThreshold)
+	}
+	return CompressRequestBody(request, encoding, threshold)
+}
+
+// setHeaderValue replaces the value of key in headers ignoring case
+func setHeaderValue(headers map[string]*string, key, value string) {
+	for name := range headers {
+		if strings.EqualFold(name, key) {
+			delete(headers, name)
+		}
+	}
+	headers[key] = String(value)
+}
+
+// isSupportedEncoding reports whether a body with the content-encoding is decoded
+func isSupportedEncoding(encoding string) bool {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case EncodingGzip, "x-gzip", EncodingDeflate, EncodingZstd:
+		return true
+	}
+	return false
+}
+
+// decompressingReader decodes a response body. The decoder is created on the
+// first Read, so the encoded stream can still be wrapped until then.
+type decompressingReader struct {
+	raw      io.ReadCloser
+	source   io.Reader
+	encoding string
+	decoder  io.Reader
+	err      error
+}
+
+func newDecompressingReader(body io.ReadCloser, encoding string) *decompressingReader {
+	return &decompressingReader{
+		raw:      body,
+		source:   body,
+		encoding: strings.ToLower(strings.TrimSpace(encoding)),
+	}
+}
+
+func (reader *decompressingReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	if reader.decoder == nil {
+		decoder, err := reader.newDecoder()
+		if err != nil {
+			reader.err = err
+			return 0, err
+		}
+		reader.decoder = decoder
+	}
+	n, err := reader.decoder.Read(p)
+	if err == io.EOF {
+		// read the encoded stream to its end so that wrappers of it see EOF
+		if _, drainErr := io.Copy(ioutil.Discard, reader.source); drainErr != nil {
+			err = drainErr
+		}
+	}
+	if err != nil {
+		reader.err = err
+	}
+	return n, err
+}
+
+func (reader *decompressingReader) newDecoder() (io.Reader, error) {
+	switch reader.encoding {
+	case EncodingGzip, "x-gzip":
+		return gzip.NewReader(reader.source)
+	case EncodingDeflate:
+		// servers send either a zlib stream or raw deflate data
+		buffered := bufio.NewReader(reader.source)
+		header, err := buffered.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(reader.source, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("dara: unsupported content encoding %q", reader.encoding)
+}
+
+func (reader *decompressingReader) Close() error {
+	if closer, ok := reader.decoder.(io.Closer); ok {
+		closer.Close()
+	}
+	return reader.raw.Close()
+}
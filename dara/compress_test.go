@@ -0,0 +1,257 @@
+package dara
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+	"github.com/klauspost/compress/zstd"
+)
+
+func encodeBody(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		writer = gzip.NewWriter(&buf)
+	case EncodingDeflate:
+		writer = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case EncodingZstd:
+		var err error
+		writer, err = zstd.NewWriter(&buf)
+		utils.AssertNil(t, err)
+	}
+	writer.Write(data)
+	utils.AssertNil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func Test_CompressRequestBody(t *testing.T) {
+	payload := strings.Repeat("compressible ", 100)
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate, EncodingZstd} {
+		request := NewRequest()
+		request.Body = strings.NewReader(payload)
+		request.Headers["Content-MD5"] = String("stale")
+		utils.AssertNil(t, CompressRequestBody(request, encoding, 1024))
+		utils.AssertEqual(t, encoding, StringValue(request.Headers["content-encoding"]))
+		compressed, _ := ioutil.ReadAll(request.Body)
+		utils.AssertEqual(t, strconv.Itoa(len(compressed)), StringValue(request.Headers["content-length"]))
+		sum := md5.Sum(compressed)
+		utils.AssertEqual(t, base64.StdEncoding.EncodeToString(sum[:]), StringValue(request.Headers["content-md5"]))
+		utils.AssertNil(t, request.Headers["Content-MD5"])
+
+		reader := newDecompressingReader(ioutil.NopCloser(bytes.NewReader(compressed)), encoding)
+		decoded, err := ioutil.ReadAll(reader)
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, payload, string(decoded))
+		utils.AssertNil(t, reader.Close())
+	}
+
+	// small and already encoded bodies are left as is
+	request := NewRequest()
+	request.Body = strings.NewReader("small")
+	utils.AssertNil(t, CompressRequestBody(request, EncodingGzip, 1024))
+	utils.AssertNil(t, request.Headers["content-encoding"])
+	byt, _ := ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, "small", string(byt))
+
+	request.Body = strings.NewReader(payload)
+	request.Headers["Content-Encoding"] = String("br")
+	utils.AssertNil(t, CompressRequestBody(request, EncodingGzip, 0))
+	byt, _ = ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, payload, string(byt))
+
+	err := CompressRequestBody(request, "br", 0)
+	utils.AssertEqual(t, `dara: unsupported content encoding "br"`, err.Error())
+
+	// bodies larger than the limit are sent as they are without being read
+	defer func(limit int64) { maxCompressionBodySize = limit }(maxCompressionBodySize)
+	maxCompressionBodySize = 100
+	reader := strings.NewReader(payload)
+	request = NewRequest()
+	request.Body = reader
+	utils.AssertNil(t, CompressRequestBody(request, EncodingGzip, 0))
+	utils.AssertNil(t, request.Headers["content-encoding"])
+	utils.AssertEqual(t, len(payload), reader.Len())
+
+	// only the limit of a body of unknown length is read
+	stream := &chunkReader{data: payload, chunk: 10}
+	request.Body = stream
+	utils.AssertNil(t, CompressRequestBody(request, EncodingGzip, 0))
+	utils.AssertNil(t, request.Headers["content-encoding"])
+	utils.AssertEqual(t, len(payload)-110, len(stream.data))
+	byt, _ = ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, payload, string(byt))
+
+	request.Body = &chunkReader{data: payload[:100], chunk: 10}
+	utils.AssertNil(t, CompressRequestBody(request, EncodingGzip, 0))
+	utils.AssertEqual(t, EncodingGzip, StringValue(request.Headers["content-encoding"]))
+}
+
+func Test_readBodyPrefix(t *testing.T) {
+	request := NewRequest()
+	byt, complete, err := readBodyPrefix(request, 4)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, complete)
+	utils.AssertEqual(t, 0, len(byt))
+
+	reader := strings.NewReader("seekable")
+	reader.Seek(2, io.SeekStart)
+	request.Body = reader
+	byt, complete, err = readBodyPrefix(request, 4)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, false, complete)
+	utils.AssertEqual(t, "ekab", string(byt))
+	utils.AssertEqual(t, 6, reader.Len())
+
+	request.Body = &chunkReader{data: "stream", chunk: 1}
+	byt, complete, err = readBodyPrefix(request, 6)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, complete)
+	utils.AssertEqual(t, "stream", string(byt))
+	byt, _ = ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, "stream", string(byt))
+}
+
+func Test_DoRequestWithCompression(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	payload := strings.Repeat("compressible ", 100)
+	var responseEncoding string
+	var received []byte
+	var receivedLength int64
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			receivedLength = req.ContentLength
+			received = nil
+			if req.Body != nil {
+				body, _ := ioutil.ReadAll(req.Body)
+				if strings.Join(foldValues(req.Header, "content-encoding"), "") == EncodingGzip {
+					reader, err := gzip.NewReader(bytes.NewReader(body))
+					utils.AssertNil(t, err)
+					body, _ = ioutil.ReadAll(reader)
+				}
+				received = body
+			}
+			header := http.Header{}
+			body := []byte(payload)
+			if responseEncoding != "" {
+				encoding := responseEncoding
+				if encoding == "raw-deflate" {
+					encoding = EncodingDeflate
+				}
+				header.Set("Content-Encoding", encoding)
+				body = encodeBody(t, responseEncoding, body)
+			}
+			header.Set("Content-Length", strconv.Itoa(len(body)))
+			return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body))}, nil
+		}
+	}
+
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Headers["accept-encoding"] = String("gzip, deflate, zstd")
+	request.Body = strings.NewReader(payload)
+	runtime := &RuntimeObject{RequestCompression: String(EncodingGzip)}
+	_, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, payload, string(received))
+	utils.AssertEqual(t, true, receivedLength > 0 && receivedLength < int64(len(payload)))
+
+	for _, encoding := range []string{EncodingGzip, EncodingDeflate, "raw-deflate", EncodingZstd} {
+		responseEncoding = encoding
+		request = NewRequest()
+		request.Headers["accept-encoding"] = String("gzip, deflate, zstd")
+		response, err := DoRequest(request, nil)
+		utils.AssertNil(t, err)
+		utils.AssertNil(t, response.Headers["content-encoding"])
+		utils.AssertNil(t, response.Headers["content-length"])
+		byt, err := response.ReadBody()
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, payload, string(byt))
+	}
+
+	responseEncoding = EncodingGzip
+	response, err := DoRequest(NewRequest(), &RuntimeObject{DisableResponseDecompression: Bool(true)})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, EncodingGzip, StringValue(response.Headers["content-encoding"]))
+	byt, _ := response.ReadBody()
+	utils.AssertEqual(t, string(encodeBody(t, EncodingGzip, []byte(payload))), string(byt))
+}
+
+func Test_VerifyDecompressedResponseChecksum(t *testing.T) {
+	payload := []byte(strings.Repeat("compressible ", 100))
+	encoded := encodeBody(t, EncodingGzip, payload)
+	sum := md5.Sum(encoded)
+	response := &Response{
+		Body:    newDecompressingReader(ioutil.NopCloser(bytes.NewReader(encoded)), EncodingGzip),
+		Headers: map[string]*string{"content-md5": String(base64.StdEncoding.EncodeToString(sum[:]))},
+	}
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+	byt, err := response.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, string(payload), string(byt))
+
+	response = &Response{
+		Body:    newDecompressingReader(ioutil.NopCloser(bytes.NewReader(encoded)), EncodingGzip),
+		Headers: map[string]*string{"content-md5": String("invalid")},
+	}
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+	_, err = response.ReadBody()
+	_, ok := err.(*IntegrityError)
+	utils.AssertEqual(t, true, ok)
+
+	// the encoded body is verified whatever DoRequest wraps around the decoder
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Encoding", EncodingGzip)
+			header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+			header.Set("Content-Type", "text/plain")
+			return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(bytes.NewReader(encoded)),
+				ContentLength: int64(len(encoded))}, nil
+		}
+	}
+	logger := utils.NewLogger("info", "", new(bytes.Buffer), "{res_body}")
+	logger.SetBodyLimit(16)
+	for _, runtime := range []*RuntimeObject{
+		{Listener: &recordListener{}},
+		{MaxResponseBodySize: Int(len(payload))},
+		{Logger: logger},
+	} {
+		response, err = DoRequest(NewRequest(), runtime)
+		utils.AssertNil(t, err)
+		utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5"))
+		byt, err = response.ReadBody()
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, string(payload), string(byt))
+	}
+
+	utils.AssertEqual(t, "compressible com"+truncatedSuffix, logger.GetLastLogMsg())
+
+	// the encoded bytes decoding consumed can not be verified anymore
+	response, err = DoRequest(NewRequest(), &RuntimeObject{})
+	utils.AssertNil(t, err)
+	response.Body.Read(make([]byte, 1))
+	err = VerifyResponseChecksum(response, ChecksumMD5, "Content-MD5")
+	utils.AssertEqual(t, "dara: the md5 checksum of a decompressed body must be verified before the body is read", err.Error())
+
+	reader := newDecompressingReader(ioutil.NopCloser(strings.NewReader("not gzip")), EncodingGzip)
+	_, err = ioutil.ReadAll(reader)
+	utils.AssertNotNil(t, err)
+}
@@ -0,0 +1,152 @@
+package dara
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// NewCookieJar returns an in-memory cookie jar which rejects cookies set for
+// a public suffix such as com or co.uk
+func NewCookieJar() (http.CookieJar, error) {
+	return cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+}
+
+// FileCookieJar is a cookie jar saved to a JSON file each time cookies are set,
+// session cookies included
+type FileCookieJar struct {
+	sync.Mutex
+	jar     *cookiejar.Jar
+	path    string
+	cookies map[string]*persistedCookie
+}
+
+// persistedCookie is the file format of a cookie
+type persistedCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"httpOnly,omitempty"`
+}
+
+// NewFileCookieJar loads the cookies saved at path, a missing file is an empty jar
+func NewFileCookieJar(path string) (*FileCookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	fileJar := &FileCookieJar{
+		jar:     jar,
+		path:    path,
+		cookies: make(map[string]*persistedCookie),
+	}
+	byt, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fileJar, nil
+	} else if err != nil {
+		return nil, err
+	}
+	saved := make([]*persistedCookie, 0)
+	if err = json.Unmarshal(byt, &saved); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, cookie := range saved {
+		u, err := url.Parse(cookie.URL)
+		if err != nil || (!cookie.Expires.IsZero() && cookie.Expires.Before(now)) {
+			continue
+		}
+		fileJar.jar.SetCookies(u, []*http.Cookie{cookie.httpCookie()})
+		fileJar.cookies[cookie.key(u)] = cookie
+	}
+	return fileJar, nil
+}
+
+// SetCookies stores cookies received from u and saves the jar
+func (fileJar *FileCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	fileJar.Lock()
+	defer fileJar.Unlock()
+	fileJar.jar.SetCookies(u, cookies)
+	now := time.Now()
+	for _, cookie := range cookies {
+		saved := &persistedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Expires:  cookie.Expires,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		if cookie.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		}
+		if cookie.MaxAge < 0 || (!saved.Expires.IsZero() && saved.Expires.Before(now)) {
+			delete(fileJar.cookies, saved.key(u))
+			continue
+		}
+		fileJar.cookies[saved.key(u)] = saved
+	}
+	fileJar.save()
+}
+
+// Cookies returns the cookies to send to u
+func (fileJar *FileCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return fileJar.jar.Cookies(u)
+}
+
+// Save writes the cookies to the file of the jar
+func (fileJar *FileCookieJar) Save() error {
+	fileJar.Lock()
+	defer fileJar.Unlock()
+	return fileJar.save()
+}
+
+func (fileJar *FileCookieJar) save() error {
+	saved := make([]*persistedCookie, 0, len(fileJar.cookies))
+	for _, cookie := range fileJar.cookies {
+		saved = append(saved, cookie)
+	}
+	byt, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fileJar.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, byt, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileJar.path)
+}
+
+// key identifies a cookie the way a jar replaces it: by domain, path and name
+func (cookie *persistedCookie) key(u *url.URL) string {
+	domain := cookie.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	return domain + ";" + cookie.Path + ";" + cookie.Name
+}
+
+func (cookie *persistedCookie) httpCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   cookie.Domain,
+		Path:     cookie.Path,
+		Expires:  cookie.Expires,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+	}
+}
@@ -0,0 +1,102 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_NewCookieJar(t *testing.T) {
+	jar, err := NewCookieJar()
+	utils.AssertNil(t, err)
+	u, _ := url.Parse("http://console.example.com/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1", Domain: "example.com"},
+		{Name: "suffix", Value: "2", Domain: "com"},
+	})
+	other, _ := url.Parse("http://api.example.com/")
+	cookies := jar.Cookies(other)
+	utils.AssertEqual(t, 1, len(cookies))
+	utils.AssertEqual(t, "session", cookies[0].Name)
+
+	// a public suffix can not carry cookies for its sub domains
+	u, _ = url.Parse("http://foo.co.uk/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "suffix", Value: "3", Domain: "co.uk"}})
+	u, _ = url.Parse("http://bar.co.uk/")
+	utils.AssertEqual(t, 0, len(jar.Cookies(u)))
+}
+
+func Test_FileCookieJar(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "cookie")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "cookies.json")
+
+	jar, err := NewFileCookieJar(path)
+	utils.AssertNil(t, err)
+	u, _ := url.Parse("https://console.example.com/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1", Path: "/"},
+		{Name: "remember", Value: "2", Domain: "example.com", Path: "/", MaxAge: 3600},
+		{Name: "expired", Value: "3", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	jar.SetCookies(u, []*http.Cookie{{Name: "session", Value: "4", Path: "/"}})
+	utils.AssertEqual(t, 2, len(jar.Cookies(u)))
+
+	loaded, err := NewFileCookieJar(path)
+	utils.AssertNil(t, err)
+	values := make(map[string]string)
+	for _, cookie := range loaded.Cookies(u) {
+		values[cookie.Name] = cookie.Value
+	}
+	utils.AssertEqual(t, map[string]string{"session": "4", "remember": "2"}, values)
+	other, _ := url.Parse("https://api.example.com/")
+	utils.AssertEqual(t, 1, len(loaded.Cookies(other)))
+
+	// a negative max age deletes the cookie
+	loaded.SetCookies(u, []*http.Cookie{{Name: "session", Path: "/", MaxAge: -1}})
+	loaded, err = NewFileCookieJar(path)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(loaded.Cookies(u)))
+	utils.AssertNil(t, loaded.Save())
+
+	utils.AssertNil(t, ioutil.WriteFile(path, []byte("invalid"), 0600))
+	_, err = NewFileCookieJar(path)
+	utils.AssertNotNil(t, err)
+}
+
+func Test_DoRequestWithCookieJar(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Cookie"))
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	send := func(path string, runtime *RuntimeObject) {
+		request := NewRequest()
+		request.Headers["host"] = String(serverURL.Host)
+		request.Pathname = String(path)
+		response, err := DoRequest(request, runtime)
+		utils.AssertNil(t, err)
+		response.ReadBody()
+	}
+
+	jar, err := NewCookieJar()
+	utils.AssertNil(t, err)
+	runtime := &RuntimeObject{CookieJar: jar}
+	send("/login", runtime)
+	send("/profile", runtime)
+	send("/profile", nil)
+	utils.AssertEqual(t, []string{"", "session=abc", "session=abc", ""}, received)
+}
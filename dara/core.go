@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"net"
@@ -78,6 +79,19 @@ type Request struct {
 	Headers  map[string]*string
 	Query    map[string]*string
 	Body     io.Reader
+
+	// bodySource and bodyOffset remember where Body started so it can be sent
+	// again, bodyOrigin is the reader Body was set to
+	bodyOrigin io.Reader
+	bodySource io.Reader
+	bodyOffset int64
+	// spool is the temporary file Body was spooled to, removed by Close
+	spool *spooledFile
+	// extraHeaders and extraQuery hold the values following the one in Headers and Query
+	extraHeaders map[string][]string
+	extraQuery   map[string][]string
+	// idempotencyToken is the client token DoRequest sends, set by SetIdempotencyToken
+	idempotencyToken string
 }
 
 // Response is use d wrap http response
@@ -86,6 +100,15 @@ type Response struct {
 	StatusCode    *int
 	StatusMessage *string
 	Headers       map[string]*string
+	// RawHeaders holds every response header as received
+	RawHeaders http.Header
+
+	// decoder decodes Body when it was received compressed, whatever wraps it
+	decoder *decompressingReader
+	// bodyLimit is the RuntimeObject.MaxResponseBodySize of the response and
+	// bodyContentLength the length of Body when it is known, -1 otherwise
+	bodyLimit         int64
+	bodyContentLength int64
 }
 
 // RuntimeObject is used for converting http configuration
@@ -108,19 +131,62 @@ type RuntimeObject struct {
 	Logger            *utils.Logger          `json:"logger" xml:"logger"`
 	RetryOptions      *RetryOptions          `json:"retryOptions" xml:"retryOptions"`
 	ExtendsParameters *ExtendsParameters     `json:"extendsParameters,omitempty" xml:"extendsParameters,omitempty"`
+	// ProgressInterval is the minimum number of milliseconds between two data events
+	ProgressInterval *int `json:"progressInterval" xml:"progressInterval"`
+	// UploadBandwidthLimit is the maximum request body bytes per second
+	UploadBandwidthLimit *int `json:"uploadBandwidthLimit" xml:"uploadBandwidthLimit"`
+	// DownloadBandwidthLimit is the maximum response body bytes per second
+	DownloadBandwidthLimit *int `json:"downloadBandwidthLimit" xml:"downloadBandwidthLimit"`
+	// BodySpoolLimit is the maximum number of bytes of a non-seekable request body buffered so it can be sent again
+	BodySpoolLimit *int `json:"bodySpoolLimit" xml:"bodySpoolLimit"`
+	// BodyMemoryLimit is the number of spooled bytes kept in memory, the rest goes to a temporary file
+	BodyMemoryLimit *int `json:"bodyMemoryLimit" xml:"bodyMemoryLimit"`
+	// DisableResponseDecompression keeps response bodies encoded as their Content-Encoding says,
+	// the default client does not ask for gzip on its own either
+	DisableResponseDecompression *bool `json:"disableResponseDecompression" xml:"disableResponseDecompression"`
+	// RequestCompression is the encoding of request bodies: gzip, deflate or zstd
+	RequestCompression *string `json:"requestCompression" xml:"requestCompression"`
+	// RequestCompressionThreshold is the smallest request body compressed
+	RequestCompressionThreshold *int `json:"requestCompressionThreshold" xml:"requestCompressionThreshold"`
+	// MaxResponseBodySize is the largest body the helpers reading a whole response into memory accept
+	MaxResponseBodySize *int `json:"maxResponseBodySize" xml:"maxResponseBodySize"`
+	// RedirectPolicy controls how the default client follows redirects
+	RedirectPolicy *RedirectPolicy `json:"redirectPolicy" xml:"redirectPolicy"`
+	// CookieJar stores the cookies of the default client, none are kept when it is nil
+	CookieJar http.CookieJar `json:"cookieJar" xml:"cookieJar"`
+	// HeaderCase is the case of request header names: preserve, canonical or lowercase
+	HeaderCase *string `json:"headerCase" xml:"headerCase"`
+	// QueryEncoding is how the query string is encoded: form, the default of a zero
+	// RuntimeObject, or rfc3986, the default of NewRuntimeObject
+	QueryEncoding *string `json:"queryEncoding" xml:"queryEncoding"`
+	// Signer signs every request sent, after its body is compressed
+	Signer Signer `json:"signer" xml:"signer"`
+	// DisableClockSkewCorrection signs requests with the local time instead of the time of the server
+	DisableClockSkewCorrection *bool `json:"disableClockSkewCorrection" xml:"disableClockSkewCorrection"`
+	// Idempotency sends a client token with every request
+	Idempotency *IdempotencyOptions `json:"idempotency" xml:"idempotency"`
 	HttpClient
 }
 
 func (r *RuntimeObject) getClientTag(domain string) string {
 	return strconv.FormatBool(BoolValue(r.IgnoreSSL)) + strconv.Itoa(IntValue(r.ReadTimeout)) +
 		strconv.Itoa(IntValue(r.ConnectTimeout)) + StringValue(r.LocalAddr) + StringValue(r.HttpProxy) +
-		StringValue(r.HttpsProxy) + StringValue(r.NoProxy) + StringValue(r.Socks5Proxy) + StringValue(r.Socks5NetWork) + domain
+		StringValue(r.HttpsProxy) + StringValue(r.NoProxy) + StringValue(r.Socks5Proxy) + StringValue(r.Socks5NetWork) + domain +
+		r.getCookieJarTag() + strconv.FormatBool(BoolValue(r.DisableResponseDecompression))
+}
+
+// getCookieJarTag gives each cookie jar its own pooled client
+func (r *RuntimeObject) getCookieJarTag() string {
+	if r.CookieJar == nil {
+		return ""
+	}
+	return fmt.Sprintf("jar%p", r.CookieJar)
 }
 
 // NewRuntimeObject is used for shortly create runtime object
 func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 	if runtime == nil {
-		return &RuntimeObject{}
+		return &RuntimeObject{QueryEncoding: String(QueryEncodingRFC3986)}
 	}
 
 	runtimeObject := &RuntimeObject{
@@ -138,6 +204,21 @@ func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 		Cert:           TransInterfaceToString(runtime["cert"]),
 		Ca:             TransInterfaceToString(runtime["ca"]),
 	}
+	runtimeObject.ProgressInterval = TransInterfaceToInt(runtime["progressInterval"])
+	runtimeObject.UploadBandwidthLimit = TransInterfaceToInt(runtime["uploadBandwidthLimit"])
+	runtimeObject.DownloadBandwidthLimit = TransInterfaceToInt(runtime["downloadBandwidthLimit"])
+	runtimeObject.BodySpoolLimit = TransInterfaceToInt(runtime["bodySpoolLimit"])
+	runtimeObject.BodyMemoryLimit = TransInterfaceToInt(runtime["bodyMemoryLimit"])
+	runtimeObject.DisableResponseDecompression = TransInterfaceToBool(runtime["disableResponseDecompression"])
+	runtimeObject.RequestCompression = TransInterfaceToString(runtime["requestCompression"])
+	runtimeObject.RequestCompressionThreshold = TransInterfaceToInt(runtime["requestCompressionThreshold"])
+	runtimeObject.MaxResponseBodySize = TransInterfaceToInt(runtime["maxResponseBodySize"])
+	runtimeObject.HeaderCase = TransInterfaceToString(runtime["headerCase"])
+	runtimeObject.DisableClockSkewCorrection = TransInterfaceToBool(runtime["disableClockSkewCorrection"])
+	runtimeObject.QueryEncoding = String(QueryEncodingRFC3986)
+	if runtime["queryEncoding"] != nil {
+		runtimeObject.QueryEncoding = TransInterfaceToString(runtime["queryEncoding"])
+	}
 	if runtime["listener"] != nil {
 		runtimeObject.Listener = runtime["listener"].(utils.ProgressListener)
 	}
@@ -153,6 +234,18 @@ func NewRuntimeObject(runtime map[string]interface{}) *RuntimeObject {
 	if runtime["retryOptions"] != nil {
 		runtimeObject.RetryOptions = runtime["retryOptions"].(*RetryOptions)
 	}
+	if runtime["redirectPolicy"] != nil {
+		runtimeObject.RedirectPolicy = runtime["redirectPolicy"].(*RedirectPolicy)
+	}
+	if runtime["idempotency"] != nil {
+		runtimeObject.Idempotency = runtime["idempotency"].(*IdempotencyOptions)
+	}
+	if runtime["signer"] != nil {
+		runtimeObject.Signer = runtime["signer"].(Signer)
+	}
+	if runtime["cookieJar"] != nil {
+		runtimeObject.CookieJar = runtime["cookieJar"].(http.CookieJar)
+	}
 	return runtimeObject
 }
 
@@ -169,6 +262,7 @@ func NewResponse(httpResponse *http.Response) (res *Response) {
 	res = &Response{}
 	res.Body = httpResponse.Body
 	res.Headers = make(map[string]*string)
+	res.RawHeaders = httpResponse.Header
 	res.StatusCode = Int(httpResponse.StatusCode)
 	res.StatusMessage = String(httpResponse.Status)
 	return
@@ -193,27 +287,37 @@ func Recover(in interface{}) error {
 
 // ReadBody is used read response body
 func (response *Response) ReadBody() (body []byte, err error) {
-	var buffer [512]byte
+	return response.ReadBodyWithLimit(response.bodyLimit)
+}
+
+// ReadBodyWithLimit returns a *ResponseTooLargeError when the body has more than limit bytes
+func (response *Response) ReadBodyWithLimit(limit int64) (body []byte, err error) {
 	defer response.Body.Close()
-	result := bytes.NewBuffer(nil)
-
-	for {
-		n, err := response.Body.Read(buffer[0:])
-		result.Write(buffer[0:n])
-		if err != nil && err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		}
+	return readAllWithLimit(response.Body, limit)
+}
+
+type defaultClientKey struct{}
+
+// withDefaultClient attaches the pooled client of the runtime to httpRequest,
+// for the HttpClient wrappers which do not wrap a client of their own
+func withDefaultClient(httpRequest *http.Request, client *daraClient) *http.Request {
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), defaultClientKey{}, client))
+}
+
+// defaultClientOf returns the pooled client attached to request, or a client
+// sending through transport when request was not built by DoRequest
+func defaultClientOf(request *http.Request, transport *http.Transport) HttpClient {
+	if client, ok := request.Context().Value(defaultClientKey{}).(*daraClient); ok {
+		return client
 	}
-	return result.Bytes(), nil
+	return &daraClient{httpClient: &http.Client{Transport: transport, CheckRedirect: checkRedirect}}
 }
 
 func getDaraClient(tag string) *daraClient {
 	client, ok := clientPool.Load(tag)
 	if client == nil && !ok {
 		client = &daraClient{
-			httpClient: &http.Client{},
+			httpClient: &http.Client{CheckRedirect: checkRedirect},
 			ifInit:     false,
 		}
 		clientPool.Store(tag, client)
@@ -226,10 +330,23 @@ func DoRequest(request *Request, runtimeObject *RuntimeObject) (response *Respon
 	if runtimeObject == nil {
 		runtimeObject = &RuntimeObject{}
 	}
+	offset := ClockOffset(StringValue(getRequestDomain(request)))
+	response, err = doRequest(request, runtimeObject)
+	if err == nil && shouldRetryClockSkew(request, runtimeObject, response, offset) {
+		debugLog("> clock skew of %s corrected, sending the request again", StringValue(request.Domain))
+		response.Body.Close()
+		return doRequest(request, runtimeObject)
+	}
+	return
+}
+
+func doRequest(request *Request, runtimeObject *RuntimeObject) (response *Response, err error) {
 	fieldMap := make(map[string]string)
 	utils.InitLogMsg(fieldMap)
+	// logOnClose leaves the log to the captured response body
+	logOnClose := false
 	defer func() {
-		if runtimeObject.Logger != nil {
+		if runtimeObject.Logger != nil && (err != nil || !logOnClose) {
 			runtimeObject.Logger.PrintLog(fieldMap, err)
 		}
 	}()
@@ -243,97 +360,178 @@ func DoRequest(request *Request, runtimeObject *RuntimeObject) (response *Respon
 		request.Protocol = String(strings.ToLower(StringValue(request.Protocol)))
 	}
 
-	requestURL := ""
-	request.Domain = request.Headers["host"]
-	if request.Port != nil {
-		request.Domain = String(fmt.Sprintf("%s:%d", StringValue(request.Domain), IntValue(request.Port)))
+	if err = checkHeaderCase(StringValue(runtimeObject.HeaderCase)); err != nil {
+		return
 	}
-	requestURL = fmt.Sprintf("%s://%s%s", StringValue(request.Protocol), StringValue(request.Domain), StringValue(request.Pathname))
-	queryParams := request.Query
-	// sort QueryParams by key
-	q := url.Values{}
-	for key, value := range queryParams {
-		q.Add(key, StringValue(value))
+	request.Domain = getRequestDomain(request)
+	if err = checkQueryEncoding(StringValue(runtimeObject.QueryEncoding)); err != nil {
+		return
 	}
-	querystring := q.Encode()
-	if len(querystring) > 0 {
-		if strings.Contains(requestURL, "?") {
-			requestURL = fmt.Sprintf("%s&%s", requestURL, querystring)
-		} else {
-			requestURL = fmt.Sprintf("%s?%s", requestURL, querystring)
-		}
+
+	if err = compressRequest(request, runtimeObject); err != nil {
+		return
+	}
+	getBody, err := prepareRequestBody(request, runtimeObject)
+	if err != nil {
+		return
+	}
+	if err = signRequest(request, runtimeObject); err != nil {
+		return
 	}
+	requestURL := buildRequestURL(request, StringValue(runtimeObject.QueryEncoding))
 	debugLog("> %s %s", StringValue(request.Method), requestURL)
-
-	httpRequest, err := http.NewRequest(StringValue(request.Method), requestURL, request.Body)
+	body := request.Body
+	if _, ok := body.(io.Closer); ok && getBody != nil {
+		// the transport must not close a body which is sent again
+		body = ioutil.NopCloser(body)
+	}
+	httpRequest, err := http.NewRequest(StringValue(request.Method), requestURL, body)
 	if err != nil {
 		return
 	}
+	if getBody != nil {
+		httpRequest.GetBody = getBody
+	}
+	httpRequest = withRedirectPolicy(httpRequest, runtimeObject.RedirectPolicy)
+	setContentLength(httpRequest, request)
 	httpRequest.Host = StringValue(request.Domain)
-
-	var client HttpClient
-	if runtimeObject.HttpClient == nil {
-		client = getDaraClient(runtimeObject.getClientTag(StringValue(request.Domain)))
-	} else {
-		client = runtimeObject.HttpClient
+	bodyLimit := runtimeObject.Logger.GetBodyLimit()
+	redactKeys := runtimeObject.Logger.GetRedactKeys()
+	var reqCapture *bodyCapture
+	if bodyLimit > 0 && httpRequest.Body != nil && httpRequest.Body != http.NoBody &&
+		utils.IsTextContentType(getHeaderValue(request.Headers, "content-type")) {
+		reqCapture = newBodyCapture(bodyLimit)
+		httpRequest.Body = &captureReadCloser{ReadCloser: httpRequest.Body, capture: reqCapture}
 	}
 
 	trans, err := getHttpTransport(request, runtimeObject)
 	if err != nil {
 		return
 	}
-	if defaultClient, ok := client.(*daraClient); ok {
-		defaultClient.Lock()
-		if !defaultClient.ifInit || defaultClient.httpClient.Transport == nil {
-			defaultClient.httpClient.Transport = trans
-		}
-		defaultClient.httpClient.Timeout = time.Duration(IntValue(runtimeObject.ReadTimeout)) * time.Millisecond
-		defaultClient.ifInit = true
-		defaultClient.Unlock()
+	defaultClient := getDaraClient(runtimeObject.getClientTag(StringValue(request.Domain)))
+	defaultClient.Lock()
+	if !defaultClient.ifInit || defaultClient.httpClient.Transport == nil {
+		defaultClient.httpClient.Transport = trans
 	}
-
-	for key, value := range request.Headers {
-		if value == nil || key == "content-length" {
-			continue
-		} else if key == "host" {
-			httpRequest.Header["Host"] = []string{*value}
-			delete(httpRequest.Header, "host")
-		} else if key == "user-agent" {
-			httpRequest.Header["User-Agent"] = []string{*value}
-			delete(httpRequest.Header, "user-agent")
-		} else {
-			httpRequest.Header[key] = []string{*value}
-		}
-		debugLog("> %s: %s", key, StringValue(value))
+	// a pooled client is shared by concurrent calls, it is only written when a setting changes
+	timeout := time.Duration(IntValue(runtimeObject.ReadTimeout)) * time.Millisecond
+	if defaultClient.httpClient.Timeout != timeout {
+		defaultClient.httpClient.Timeout = timeout
 	}
+	if defaultClient.httpClient.Jar != runtimeObject.CookieJar {
+		defaultClient.httpClient.Jar = runtimeObject.CookieJar
+	}
+	defaultClient.ifInit = true
+	defaultClient.Unlock()
+	var client HttpClient = defaultClient
+	if runtimeObject.HttpClient != nil {
+		client = runtimeObject.HttpClient
+		httpRequest = withDefaultClient(httpRequest, defaultClient)
+	}
+
+	setRequestHeaders(httpRequest.Header, request, StringValue(runtimeObject.HeaderCase))
 	contentlength, _ := strconv.Atoi(StringValue(request.Headers["content-length"]))
-	event := utils.NewProgressEvent(utils.TransferStartedEvent, 0, int64(contentlength), 0)
+	if contentlength == 0 && httpRequest.ContentLength > 0 {
+		contentlength = int(httpRequest.ContentLength)
+	}
+	// the bytes the tracker already counts are part of the transfer
+	uploaded := int64(0)
+	if runtimeObject.Tracker != nil {
+		uploaded = runtimeObject.Tracker.GetCompletedBytes()
+	}
+	uploadTotal := int64(0)
+	if contentlength > 0 {
+		uploadTotal = uploaded + int64(contentlength)
+	}
+	event := utils.NewProgressEvent(utils.TransferStartedEvent, uploaded, uploadTotal, 0)
 	utils.PublishProgress(runtimeObject.Listener, event)
+	if httpRequest.Body != nil && httpRequest.Body != http.NoBody &&
+		(runtimeObject.Listener != nil || runtimeObject.Tracker != nil) {
+		httpRequest.Body = newProgressReader(httpRequest.Body, utils.TransferDataEvent, runtimeObject,
+			runtimeObject.Tracker, uploaded, uploadTotal)
+	}
+	globalUpload, globalDownload := getGlobalBandwidthLimiters()
+	if httpRequest.Body != nil && httpRequest.Body != http.NoBody {
+		httpRequest.Body = newThrottledReader(httpRequest.Body,
+			newBandwidthLimiter(IntValue(runtimeObject.UploadBandwidthLimit)), globalUpload)
+	}
 
-	putMsgToMap(fieldMap, httpRequest)
+	putMsgToMap(fieldMap, httpRequest, redactKeys)
 	startTime := time.Now()
 	fieldMap["{start_time}"] = startTime.Format("2006-01-02 15:04:05")
 	res, err := hookDo(client.Call)(httpRequest, trans)
 	fieldMap["{cost}"] = time.Since(startTime).String()
+	if reqCapture != nil {
+		fieldMap["{req_body}"] = reqCapture.String(redactKeys)
+	}
 	completedBytes := int64(0)
 	if runtimeObject.Tracker != nil {
-		completedBytes = runtimeObject.Tracker.CompletedBytes
+		completedBytes = runtimeObject.Tracker.GetCompletedBytes()
+	}
+	if uploadTotal > 0 && completedBytes > uploadTotal {
+		uploadTotal = completedBytes
 	}
 	if err != nil {
-		event = utils.NewProgressEvent(utils.TransferFailedEvent, completedBytes, int64(contentlength), 0)
+		event = utils.NewProgressEvent(utils.TransferFailedEvent, completedBytes, uploadTotal, 0)
 		utils.PublishProgress(runtimeObject.Listener, event)
 		return
 	}
 
-	event = utils.NewProgressEvent(utils.TransferCompletedEvent, completedBytes, int64(contentlength), 0)
+	// the response body is reported with ResponseDataEvent once it is read
+	event = utils.NewProgressEvent(utils.TransferCompletedEvent, completedBytes, uploadTotal, 0)
 	utils.PublishProgress(runtimeObject.Listener, event)
+	if !BoolValue(runtimeObject.DisableClockSkewCorrection) {
+		recordClockOffset(StringValue(request.Domain), res.Header.Get("Date"), startTime, time.Now())
+	}
 
 	response = NewResponse(res)
 	fieldMap["{code}"] = strconv.Itoa(res.StatusCode)
-	fieldMap["{res_headers}"] = Stringify(res.Header)
+	fieldMap["{res_headers}"] = Stringify(utils.RedactHeaders(res.Header, redactKeys))
+	contentEncoding := res.Header.Get("Content-Encoding")
+	// a range of an encoded body can not be decoded on its own
+	decompress := res.Body != nil && !BoolValue(runtimeObject.DisableResponseDecompression) &&
+		isSupportedEncoding(contentEncoding) && res.StatusCode != http.StatusPartialContent &&
+		getHeaderValue(request.Headers, "range") == ""
+	if decompress {
+		response.decoder = newDecompressingReader(res.Body, contentEncoding)
+		response.Body = response.decoder
+	}
+	if bodyLimit > 0 && res.Body != nil && utils.IsTextContentType(res.Header.Get("Content-Type")) {
+		// the body is captured as the caller reads it, the log is printed once it is read or closed
+		resCapture := newBodyCapture(bodyLimit)
+		logger := runtimeObject.Logger
+		logOnClose = true
+		response.Body = &captureReadCloser{ReadCloser: response.Body, capture: resCapture, done: func() {
+			fieldMap["{res_body}"] = resCapture.String(redactKeys)
+			logger.PrintLog(fieldMap, nil)
+		}}
+	}
+	if runtimeObject.Listener != nil && res.Body != nil {
+		total := res.ContentLength
+		if total < 0 || decompress {
+			total = 0
+		}
+		response.Body = newProgressReader(response.Body, utils.ResponseDataEvent, runtimeObject, nil, 0, total)
+	}
+	if res.Body != nil {
+		response.Body = newThrottledReader(response.Body,
+			newBandwidthLimiter(IntValue(runtimeObject.DownloadBandwidthLimit)), globalDownload)
+	}
+	if limit := IntValue(runtimeObject.MaxResponseBodySize); limit > 0 && res.Body != nil {
+		response.bodyLimit = int64(limit)
+		response.bodyContentLength = res.ContentLength
+		if decompress {
+			response.bodyContentLength = -1
+		}
+		response.setBody(response.Body)
+	}
 	debugLog("< HTTP/1.1 %s", res.Status)
 	for key, value := range res.Header {
 		debugLog("< %s: %s", key, strings.Join(value, ""))
+		if decompress && (strings.EqualFold(key, "content-encoding") || strings.EqualFold(key, "content-length")) {
+			// the headers describe the encoded body
+			continue
+		}
 		if len(value) != 0 {
 			response.Headers[strings.ToLower(key)] = String(value[0])
 		}
@@ -341,8 +539,62 @@ func DoRequest(request *Request, runtimeObject *RuntimeObject) (response *Respon
 	return
 }
 
+// getRequestDomain returns the host header of request with its port
+func getRequestDomain(request *Request) *string {
+	domain := request.Headers["host"]
+	if request.Port != nil {
+		domain = String(fmt.Sprintf("%s:%d", StringValue(domain), IntValue(request.Port)))
+	}
+	return domain
+}
+
+// buildRequestURL builds the url which DoRequest sends request to
+func buildRequestURL(request *Request, encoding string) string {
+	protocol := "http"
+	if request.Protocol != nil {
+		protocol = strings.ToLower(StringValue(request.Protocol))
+	}
+	requestURL := fmt.Sprintf("%s://%s%s", protocol, StringValue(getRequestDomain(request)), StringValue(request.Pathname))
+	var querystring string
+	if encoding == QueryEncodingRFC3986 {
+		querystring = CanonicalQueryString(request)
+	} else {
+		// sort QueryParams by key
+		q := url.Values{}
+		for key, value := range request.Query {
+			q.Add(key, StringValue(value))
+			if value != nil {
+				for _, extra := range request.extraQuery[key] {
+					q.Add(key, extra)
+				}
+			}
+		}
+		querystring = q.Encode()
+	}
+	if len(querystring) > 0 {
+		if strings.Contains(requestURL, "?") {
+			requestURL = fmt.Sprintf("%s&%s", requestURL, querystring)
+		} else {
+			requestURL = fmt.Sprintf("%s?%s", requestURL, querystring)
+		}
+	}
+	return requestURL
+}
+
+// setRequestHeaders copies the headers of request into header the way they go on the wire
+func setRequestHeaders(header http.Header, request *Request, policy string) {
+	for _, field := range WireHeaders(request, policy) {
+		debugLog("> %s: %s", field.Name, field.Value)
+		if field.Name == "Content-Length" {
+			continue
+		}
+		header[field.Name] = append(header[field.Name], field.Value)
+	}
+}
+
 func getHttpTransport(req *Request, runtime *RuntimeObject) (*http.Transport, error) {
 	trans := new(http.Transport)
+	trans.DisableCompression = BoolValue(runtime.DisableResponseDecompression)
 	httpProxy, err := getHttpProxy(StringValue(req.Protocol), StringValue(req.Domain), runtime)
 	if err != nil {
 		return nil, err
@@ -417,16 +669,32 @@ func getHttpTransport(req *Request, runtime *RuntimeObject) (*http.Transport, er
 	return trans, nil
 }
 
-func putMsgToMap(fieldMap map[string]string, request *http.Request) {
+func putMsgToMap(fieldMap map[string]string, request *http.Request, redactKeys []string) {
 	fieldMap["{host}"] = request.Host
 	fieldMap["{method}"] = request.Method
-	fieldMap["{uri}"] = request.URL.RequestURI()
+	// the query of signed requests carries credentials
+	redacted := *request.URL
+	redacted.RawQuery = utils.RedactQuery(redacted.RawQuery, redactKeys)
+	fieldMap["{uri}"] = redacted.RequestURI()
 	fieldMap["{pid}"] = strconv.Itoa(os.Getpid())
 	fieldMap["{version}"] = strings.Split(request.Proto, "/")[1]
 	hostname, _ := os.Hostname()
 	fieldMap["{hostname}"] = hostname
-	fieldMap["{req_headers}"] = Stringify(request.Header)
-	fieldMap["{target}"] = request.URL.Path + request.URL.RawQuery
+	fieldMap["{req_headers}"] = Stringify(utils.RedactHeaders(request.Header, redactKeys))
+	fieldMap["{target}"] = redacted.Path + redacted.RawQuery
+}
+
+// getHeaderValue looks up key in headers ignoring case
+func getHeaderValue(headers map[string]*string, key string) string {
+	if value, ok := headers[key]; ok {
+		return StringValue(value)
+	}
+	for name, value := range headers {
+		if strings.EqualFold(name, key) {
+			return StringValue(value)
+		}
+	}
+	return ""
 }
 
 func getNoProxy(protocol string, runtime *RuntimeObject) []string {
@@ -0,0 +1,511 @@
+package dara
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvAccessKeyId is the environment variable read by EnvCredentialsProvider for the access key id
+	EnvAccessKeyId = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	// EnvAccessKeySecret is the environment variable read by EnvCredentialsProvider for the access key secret
+	EnvAccessKeySecret = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	// EnvSecurityToken is the environment variable read by EnvCredentialsProvider for the security token
+	EnvSecurityToken = "ALIBABA_CLOUD_SECURITY_TOKEN"
+	// EnvCredentialsFile overrides the path of the shared credentials file
+	EnvCredentialsFile = "ALIBABA_CLOUD_CREDENTIALS_FILE"
+	// EnvProfile is the profile of the shared credentials file used when none is given
+	EnvProfile = "ALIBABA_CLOUD_PROFILE"
+	// EnvECSMetadataRole is the RAM role of the instance, the default chain asks the metadata service only when it is set
+	EnvECSMetadataRole = "ALIBABA_CLOUD_ECS_METADATA"
+)
+
+// DefaultMetadataEndpoint is the address of the ECS metadata service
+const DefaultMetadataEndpoint = "http://100.100.100.200"
+
+// DefaultRefreshBefore is how long before their expiration cached credentials are refreshed
+const DefaultRefreshBefore = 3 * time.Minute
+
+// DefaultRefreshTimeout is how long a cached credential provider waits for a new credential
+const DefaultRefreshTimeout = time.Minute
+
+const (
+	// minRefreshBackoff and maxRefreshBackoff bound the wait after a failed
+	// background refresh, doubled on every failure in a row
+	minRefreshBackoff = time.Second
+	maxRefreshBackoff = time.Minute
+)
+
+// CredentialsProvider returns the credential requests are signed with
+type CredentialsProvider interface {
+	GetCredential(ctx context.Context) (*Credential, error)
+}
+
+// resolveCredential returns credential, or the one provider returns within
+// the context of signing when it is set
+func resolveCredential(signing *SigningContext, credential *Credential, provider CredentialsProvider) (*Credential, error) {
+	if provider != nil {
+		ctx := context.Background()
+		if signing != nil && signing.Context != nil {
+			ctx = signing.Context
+		}
+		var err error
+		if credential, err = provider.GetCredential(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkCredential(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// StaticCredentialsProvider always returns the same credential
+type StaticCredentialsProvider struct {
+	Credential *Credential
+}
+
+// NewStaticCredentialsProvider returns a provider of the given access key
+func NewStaticCredentialsProvider(accessKeyId, accessKeySecret, securityToken string) *StaticCredentialsProvider {
+	return &StaticCredentialsProvider{Credential: &Credential{
+		AccessKeyId:     accessKeyId,
+		AccessKeySecret: accessKeySecret,
+		SecurityToken:   securityToken,
+	}}
+}
+
+// GetCredential returns the static credential
+func (provider *StaticCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	if err := checkCredential(provider.Credential); err != nil {
+		return nil, err
+	}
+	return provider.Credential, nil
+}
+
+// EnvCredentialsProvider reads the credential from the ALIBABA_CLOUD_* environment variables
+type EnvCredentialsProvider struct{}
+
+// GetCredential returns the credential of the environment
+func (provider *EnvCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	credential := &Credential{
+		AccessKeyId:     os.Getenv(EnvAccessKeyId),
+		AccessKeySecret: os.Getenv(EnvAccessKeySecret),
+		SecurityToken:   os.Getenv(EnvSecurityToken),
+	}
+	if credential.AccessKeyId == "" || credential.AccessKeySecret == "" {
+		return nil, fmt.Errorf("dara: %s or %s is not set", EnvAccessKeyId, EnvAccessKeySecret)
+	}
+	return credential, nil
+}
+
+// ProfileCredentialsProvider reads the credential from a profile of a shared
+// credentials file in INI format:
+//
+//	[default]
+//	type = access_key
+//	access_key_id = foo
+//	access_key_secret = bar
+//
+// A profile of type sts also has a security_token.
+type ProfileCredentialsProvider struct {
+	// Path defaults to ALIBABA_CLOUD_CREDENTIALS_FILE, then ~/.alibabacloud/credentials
+	Path string
+	// Profile defaults to ALIBABA_CLOUD_PROFILE, then default
+	Profile string
+}
+
+// GetCredential returns the credential of the profile
+func (provider *ProfileCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	path := provider.Path
+	if path == "" {
+		path = os.Getenv(EnvCredentialsFile)
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".alibabacloud", "credentials")
+	}
+	profile := provider.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := parseProfile(byt, profile)
+	if !ok {
+		return nil, fmt.Errorf("dara: profile %q is not in %s", profile, path)
+	}
+	switch values["type"] {
+	case "", "access_key", "sts":
+	default:
+		return nil, fmt.Errorf("dara: unsupported type %q of profile %q", values["type"], profile)
+	}
+	credential := &Credential{
+		AccessKeyId:     values["access_key_id"],
+		AccessKeySecret: values["access_key_secret"],
+		SecurityToken:   values["security_token"],
+	}
+	if err = checkCredential(credential); err != nil {
+		return nil, fmt.Errorf("dara: profile %q has no access key", profile)
+	}
+	return credential, nil
+}
+
+// parseProfile returns the keys of section profile of an INI file
+func parseProfile(byt []byte, profile string) (map[string]string, bool) {
+	var values map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(byt))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if values != nil {
+				break
+			}
+			if strings.TrimSpace(line[1:len(line)-1]) == profile {
+				values = make(map[string]string)
+			}
+			continue
+		}
+		if values == nil {
+			continue
+		}
+		if i := strings.Index(line, "="); i > 0 {
+			values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return values, values != nil
+}
+
+// credentialDocument is the JSON returned by the metadata service and by credential processes
+type credentialDocument struct {
+	Code            string `json:"Code"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	AccessKeySecret string `json:"AccessKeySecret"`
+	SecurityToken   string `json:"SecurityToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+func parseCredentialDocument(byt []byte) (*Credential, error) {
+	document := &credentialDocument{}
+	if err := json.Unmarshal(byt, document); err != nil {
+		return nil, fmt.Errorf("dara: invalid credential document: %v", err)
+	}
+	if document.Code != "" && document.Code != "Success" {
+		return nil, fmt.Errorf("dara: credential document has code %s", document.Code)
+	}
+	credential := &Credential{
+		AccessKeyId:     document.AccessKeyId,
+		AccessKeySecret: document.AccessKeySecret,
+		SecurityToken:   document.SecurityToken,
+	}
+	if err := checkCredential(credential); err != nil {
+		return nil, errors.New("dara: credential document has no access key")
+	}
+	if document.Expiration != "" {
+		expiration, err := time.Parse(time.RFC3339, document.Expiration)
+		if err != nil {
+			return nil, fmt.Errorf("dara: invalid expiration %q", document.Expiration)
+		}
+		credential.Expiration = expiration
+	}
+	return credential, nil
+}
+
+// ProcessCredentialsProvider runs a command which prints the credential as JSON:
+//
+//	{"AccessKeyId": "...", "AccessKeySecret": "...", "SecurityToken": "...", "Expiration": "2024-01-02T03:04:05Z"}
+//
+// SecurityToken and Expiration are optional.
+type ProcessCredentialsProvider struct {
+	Command string
+	Args    []string
+}
+
+// GetCredential runs the command
+func (provider *ProcessCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	if provider.Command == "" {
+		return nil, errors.New("dara: the credential process has no command")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, provider.Command, provider.Args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("dara: credential process failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseCredentialDocument(output)
+}
+
+// MetadataCredentialsProvider gets the temporary credential of the RAM role of
+// an ECS instance from the metadata service, with a session token when the
+// service hands one out.
+type MetadataCredentialsProvider struct {
+	// Endpoint defaults to DefaultMetadataEndpoint
+	Endpoint string
+	// RoleName is asked to the service when it is empty
+	RoleName string
+	// Client defaults to a client with a 5 seconds timeout
+	Client *http.Client
+}
+
+// GetCredential asks the metadata service
+func (provider *MetadataCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	endpoint := strings.TrimRight(provider.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	client := provider.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	header := http.Header{}
+	if token, err := provider.fetch(ctx, client, "PUT", endpoint+"/latest/api/token",
+		http.Header{"X-Aliyun-Ecs-Metadata-Token-Ttl-Seconds": []string{"21600"}}); err == nil {
+		header.Set("X-Aliyun-Ecs-Metadata-Token", string(token))
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	base := endpoint + "/latest/meta-data/ram/security-credentials/"
+	roleName := provider.RoleName
+	if roleName == "" {
+		byt, err := provider.fetch(ctx, client, "GET", base, header)
+		if err != nil {
+			return nil, err
+		}
+		roleName = strings.TrimSpace(strings.SplitN(string(byt), "\n", 2)[0])
+		if roleName == "" {
+			return nil, errors.New("dara: the instance has no RAM role")
+		}
+	}
+	byt, err := provider.fetch(ctx, client, "GET", base+roleName, header)
+	if err != nil {
+		return nil, err
+	}
+	return parseCredentialDocument(byt)
+}
+
+func (provider *MetadataCredentialsProvider) fetch(ctx context.Context, client *http.Client, method, url string, header http.Header) ([]byte, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	request.Header = header
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	byt, err := readAllWithLimit(response.Body, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dara: %s %s returned %d", method, url, response.StatusCode)
+	}
+	return byt, nil
+}
+
+// ChainCredentialsProvider returns the credential of the first of its
+// providers which has one
+type ChainCredentialsProvider struct {
+	Providers []CredentialsProvider
+}
+
+// NewCredentialsProviderChain returns a chain trying providers in order
+func NewCredentialsProviderChain(providers ...CredentialsProvider) *ChainCredentialsProvider {
+	return &ChainCredentialsProvider{Providers: providers}
+}
+
+// GetCredential tries the providers in order
+func (chain *ChainCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	messages := make([]string, 0, len(chain.Providers))
+	for _, provider := range chain.Providers {
+		credential, err := provider.GetCredential(ctx)
+		if err == nil {
+			return credential, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		messages = append(messages, err.Error())
+	}
+	return nil, fmt.Errorf("dara: no credential found: [%s]", strings.Join(messages, "; "))
+}
+
+// NewDefaultCredentialsProvider returns a cached chain of the environment
+// variables, the shared credentials file and, when ALIBABA_CLOUD_ECS_METADATA
+// names a role, the metadata service
+func NewDefaultCredentialsProvider() *CachedCredentialsProvider {
+	providers := []CredentialsProvider{&EnvCredentialsProvider{}, &ProfileCredentialsProvider{}}
+	if role := os.Getenv(EnvECSMetadataRole); role != "" {
+		providers = append(providers, &MetadataCredentialsProvider{RoleName: role})
+	}
+	return NewCachedCredentialsProvider(NewCredentialsProviderChain(providers...))
+}
+
+// credentialFlight is a call to the cached provider shared by its callers
+type credentialFlight struct {
+	done       chan struct{}
+	credential *Credential
+	err        error
+}
+
+// CachedCredentialsProvider caches the credential of Provider until it
+// expires. Within RefreshBefore of its expiration the cached credential is
+// still returned while a new one is fetched in the background, failed
+// refreshes are tried again after a growing backoff; once expired, callers
+// wait for it. Concurrent callers share a single call to Provider, which
+// fails after RefreshTimeout.
+type CachedCredentialsProvider struct {
+	Provider CredentialsProvider
+	// RefreshBefore defaults to DefaultRefreshBefore
+	RefreshBefore time.Duration
+	// RefreshTimeout defaults to DefaultRefreshTimeout
+	RefreshTimeout time.Duration
+
+	mutex      sync.Mutex
+	credential *Credential
+	flight     *credentialFlight
+	// failures counts the refreshes failed in a row, no background refresh starts before retryAt
+	failures int
+	retryAt  time.Time
+}
+
+// NewCachedCredentialsProvider caches the credential of provider
+func NewCachedCredentialsProvider(provider CredentialsProvider) *CachedCredentialsProvider {
+	return &CachedCredentialsProvider{Provider: provider, RefreshBefore: DefaultRefreshBefore}
+}
+
+// GetCredential returns the cached credential, fetching it when needed
+func (cached *CachedCredentialsProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	cached.mutex.Lock()
+	credential := cached.credential
+	now := time.Now()
+	if credential != nil && (credential.Expiration.IsZero() || now.Before(credential.Expiration)) {
+		refreshBefore := cached.RefreshBefore
+		if refreshBefore <= 0 {
+			refreshBefore = DefaultRefreshBefore
+		}
+		if !credential.Expiration.IsZero() && now.Add(refreshBefore).After(credential.Expiration) &&
+			cached.flight == nil && !now.Before(cached.retryAt) {
+			cached.startFlight()
+		}
+		cached.mutex.Unlock()
+		return credential, nil
+	}
+	flight := cached.flight
+	if flight == nil {
+		flight = cached.startFlight()
+	}
+	cached.mutex.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.credential, flight.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached credential, the next call fetches a new one
+func (cached *CachedCredentialsProvider) Invalidate() {
+	cached.mutex.Lock()
+	cached.credential = nil
+	cached.mutex.Unlock()
+}
+
+// startFlight fetches a credential in the background, mutex must be held
+func (cached *CachedCredentialsProvider) startFlight() *credentialFlight {
+	flight := &credentialFlight{done: make(chan struct{})}
+	cached.flight = flight
+	timeout := cached.RefreshTimeout
+	if timeout <= 0 {
+		timeout = DefaultRefreshTimeout
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		credential, err := getCredentialWithin(ctx, cached.Provider)
+		if err == nil {
+			err = checkCredential(credential)
+		}
+		if err != nil {
+			debugLog("> refreshing the credential failed: %v", err)
+		}
+		cached.mutex.Lock()
+		if err == nil {
+			cached.credential = credential
+			cached.failures = 0
+			cached.retryAt = time.Time{}
+		} else {
+			cached.failures++
+			cached.retryAt = time.Now().Add(refreshBackoff(cached.failures))
+		}
+		cached.flight = nil
+		cached.mutex.Unlock()
+		flight.credential, flight.err = credential, err
+		if err != nil {
+			flight.credential = nil
+		}
+		close(flight.done)
+	}()
+	return flight
+}
+
+// getCredentialWithin returns the credential of provider or the error of ctx
+// once it is done, even when provider does not stop with ctx
+func getCredentialWithin(ctx context.Context, provider CredentialsProvider) (*Credential, error) {
+	type result struct {
+		credential *Credential
+		err        error
+	}
+	results := make(chan result, 1)
+	go func() {
+		credential, err := provider.GetCredential(ctx)
+		results <- result{credential, err}
+	}()
+	select {
+	case result := <-results:
+		return result.credential, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refreshBackoff returns the wait after failures refreshes failed in a row
+func refreshBackoff(failures int) time.Duration {
+	backoff := minRefreshBackoff
+	for i := 1; i < failures && backoff < maxRefreshBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRefreshBackoff {
+		backoff = maxRefreshBackoff
+	}
+	return backoff
+}
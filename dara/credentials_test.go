@@ -0,0 +1,362 @@
+package dara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// setEnv sets the environment variables and returns a function restoring them
+func setEnv(values map[string]string) func() {
+	previous := make(map[string]*string, len(values))
+	for key, value := range values {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+		if value == "" {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, value)
+		}
+	}
+	return func() {
+		for key, value := range previous {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+func Test_StaticAndEnvCredentialsProvider(t *testing.T) {
+	credential, err := NewStaticCredentialsProvider("ak", "sk", "token").GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, &Credential{AccessKeyId: "ak", AccessKeySecret: "sk", SecurityToken: "token"}, credential)
+	_, err = NewStaticCredentialsProvider("", "sk", "").GetCredential(context.Background())
+	utils.AssertNotNil(t, err)
+
+	restore := setEnv(map[string]string{EnvAccessKeyId: "envak", EnvAccessKeySecret: "envsk", EnvSecurityToken: ""})
+	defer restore()
+	credential, err = (&EnvCredentialsProvider{}).GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "envak", credential.AccessKeyId)
+	utils.AssertEqual(t, "", credential.SecurityToken)
+	os.Unsetenv(EnvAccessKeySecret)
+	_, err = (&EnvCredentialsProvider{}).GetCredential(context.Background())
+	utils.AssertEqual(t, "dara: ALIBABA_CLOUD_ACCESS_KEY_ID or ALIBABA_CLOUD_ACCESS_KEY_SECRET is not set", err.Error())
+}
+
+func Test_ProfileCredentialsProvider(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "credentials")
+	utils.AssertNil(t, ioutil.WriteFile(path, []byte(`# shared credentials
+[default]
+type = access_key
+access_key_id = foo
+access_key_secret = bar
+
+[temp]
+type = sts
+access_key_id = stsak
+access_key_secret = stssk
+security_token = token
+
+[role]
+type = ram_role_arn
+`), 0600))
+
+	credential, err := (&ProfileCredentialsProvider{Path: path}).GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, &Credential{AccessKeyId: "foo", AccessKeySecret: "bar"}, credential)
+
+	restore := setEnv(map[string]string{EnvCredentialsFile: path, EnvProfile: "temp"})
+	defer restore()
+	credential, err = (&ProfileCredentialsProvider{}).GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "token", credential.SecurityToken)
+
+	_, err = (&ProfileCredentialsProvider{Profile: "role"}).GetCredential(context.Background())
+	utils.AssertEqual(t, `dara: unsupported type "ram_role_arn" of profile "role"`, err.Error())
+	_, err = (&ProfileCredentialsProvider{Profile: "missing"}).GetCredential(context.Background())
+	utils.AssertEqual(t, fmt.Sprintf(`dara: profile "missing" is not in %s`, path), err.Error())
+	_, err = (&ProfileCredentialsProvider{Path: filepath.Join(tempDir, "none")}).GetCredential(context.Background())
+	utils.AssertNotNil(t, err)
+}
+
+func Test_ProcessCredentialsProvider(t *testing.T) {
+	provider := &ProcessCredentialsProvider{
+		Command: "sh",
+		Args:    []string{"-c", `echo '{"AccessKeyId":"pak","AccessKeySecret":"psk","SecurityToken":"pt","Expiration":"2030-01-02T03:04:05Z"}'`},
+	}
+	credential, err := provider.GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "pak", credential.AccessKeyId)
+	utils.AssertEqual(t, "pt", credential.SecurityToken)
+	utils.AssertEqual(t, "2030-01-02T03:04:05Z", credential.Expiration.Format(time.RFC3339))
+
+	provider.Args = []string{"-c", "echo denied >&2; exit 3"}
+	_, err = provider.GetCredential(context.Background())
+	utils.AssertEqual(t, "dara: credential process failed: exit status 3: denied", err.Error())
+
+	provider.Args = []string{"-c", "echo '{}'"}
+	_, err = provider.GetCredential(context.Background())
+	utils.AssertEqual(t, "dara: credential document has no access key", err.Error())
+
+	_, err = (&ProcessCredentialsProvider{}).GetCredential(context.Background())
+	utils.AssertNotNil(t, err)
+}
+
+func Test_MetadataCredentialsProvider(t *testing.T) {
+	var tokens int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			atomic.AddInt32(&tokens, 1)
+			w.Write([]byte("session"))
+		case r.Header.Get("X-Aliyun-Ecs-Metadata-Token") != "session":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/ram/security-credentials/":
+			w.Write([]byte("EcsRole"))
+		case r.URL.Path == "/latest/meta-data/ram/security-credentials/EcsRole":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"STS.ak","AccessKeySecret":"sk",` +
+				`"SecurityToken":"token","Expiration":"2030-01-02T03:04:05Z","LastUpdated":"2029-01-02T03:04:05Z"}`))
+		case r.URL.Path == "/latest/meta-data/ram/security-credentials/Failing":
+			w.Write([]byte(`{"Code":"Failed"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := &MetadataCredentialsProvider{Endpoint: server.URL + "/"}
+	credential, err := provider.GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "STS.ak", credential.AccessKeyId)
+	utils.AssertEqual(t, "token", credential.SecurityToken)
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&tokens))
+
+	provider.RoleName = "Failing"
+	_, err = provider.GetCredential(context.Background())
+	utils.AssertEqual(t, "dara: credential document has code Failed", err.Error())
+
+	provider.RoleName = "Missing"
+	_, err = provider.GetCredential(context.Background())
+	utils.AssertEqual(t, fmt.Sprintf("dara: GET %s/latest/meta-data/ram/security-credentials/Missing returned 404", server.URL), err.Error())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = provider.GetCredential(ctx)
+	utils.AssertNotNil(t, err)
+}
+
+func Test_ChainCredentialsProvider(t *testing.T) {
+	restore := setEnv(map[string]string{EnvAccessKeyId: "", EnvAccessKeySecret: ""})
+	defer restore()
+	chain := NewCredentialsProviderChain(&EnvCredentialsProvider{}, NewStaticCredentialsProvider("ak", "sk", ""))
+	credential, err := chain.GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "ak", credential.AccessKeyId)
+
+	chain = NewCredentialsProviderChain(&EnvCredentialsProvider{}, &ProcessCredentialsProvider{})
+	_, err = chain.GetCredential(context.Background())
+	utils.AssertEqual(t, "dara: no credential found: [dara: ALIBABA_CLOUD_ACCESS_KEY_ID or ALIBABA_CLOUD_ACCESS_KEY_SECRET is not set;"+
+		" dara: the credential process has no command]", err.Error())
+
+	defer setEnv(map[string]string{EnvAccessKeyId: "envak", EnvAccessKeySecret: "envsk"})()
+	credential, err = NewDefaultCredentialsProvider().GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "envak", credential.AccessKeyId)
+}
+
+// countingProvider returns a new credential expiring after ttl on every call
+type countingProvider struct {
+	calls   int32
+	ttl     time.Duration
+	delay   time.Duration
+	fail    bool
+	release chan struct{}
+}
+
+func (provider *countingProvider) GetCredential(ctx context.Context) (*Credential, error) {
+	calls := atomic.AddInt32(&provider.calls, 1)
+	if provider.release != nil {
+		<-provider.release
+	}
+	time.Sleep(provider.delay)
+	if provider.fail {
+		return nil, errors.New("provider failed")
+	}
+	credential := &Credential{AccessKeyId: fmt.Sprintf("ak%d", calls), AccessKeySecret: "sk"}
+	if provider.ttl != 0 {
+		credential.Expiration = time.Now().Add(provider.ttl)
+	}
+	return credential, nil
+}
+
+func Test_CachedCredentialsProvider(t *testing.T) {
+	// concurrent callers share one call
+	provider := &countingProvider{delay: 20 * time.Millisecond}
+	cached := NewCachedCredentialsProvider(provider)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			credential, err := cached.GetCredential(context.Background())
+			utils.AssertNil(t, err)
+			utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+		}()
+	}
+	wg.Wait()
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&provider.calls))
+	credential, _ := cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+	utils.AssertEqual(t, int32(1), atomic.LoadInt32(&provider.calls))
+
+	cached.Invalidate()
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak2", credential.AccessKeyId)
+
+	// a credential about to expire is returned while a new one is fetched
+	provider = &countingProvider{ttl: time.Minute}
+	cached = &CachedCredentialsProvider{Provider: provider, RefreshBefore: 2 * time.Minute}
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+	provider.release = make(chan struct{})
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+	close(provider.release)
+	for i := 0; i < 100 && credential.AccessKeyId == "ak1"; i++ {
+		time.Sleep(5 * time.Millisecond)
+		credential, _ = cached.GetCredential(context.Background())
+	}
+	utils.AssertEqual(t, "ak2", credential.AccessKeyId)
+
+	// an expired credential is not returned
+	provider = &countingProvider{ttl: -time.Second}
+	cached = NewCachedCredentialsProvider(provider)
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak2", credential.AccessKeyId)
+
+	// failures are returned and not cached
+	provider = &countingProvider{fail: true}
+	cached = NewCachedCredentialsProvider(provider)
+	_, err := cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "provider failed", err.Error())
+	provider.fail = false
+	credential, err = cached.GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "ak2", credential.AccessKeyId)
+
+	// waiting callers give up with their context
+	provider = &countingProvider{release: make(chan struct{})}
+	cached = NewCachedCredentialsProvider(provider)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = cached.GetCredential(ctx)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+	close(provider.release)
+}
+
+func Test_CachedCredentialsProviderRefresh(t *testing.T) {
+	// a provider which does not return fails after the refresh timeout
+	provider := &countingProvider{release: make(chan struct{})}
+	defer close(provider.release)
+	cached := &CachedCredentialsProvider{Provider: provider, RefreshTimeout: 20 * time.Millisecond}
+	_, err := cached.GetCredential(context.Background())
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+
+	// a failed background refresh is not tried again before its backoff
+	provider = &countingProvider{ttl: time.Minute}
+	cached = &CachedCredentialsProvider{Provider: provider, RefreshBefore: 2 * time.Minute}
+	credential, err := cached.GetCredential(context.Background())
+	utils.AssertNil(t, err)
+	provider.fail = true
+	waitRefresh := func() {
+		for i := 0; i < 100; i++ {
+			cached.mutex.Lock()
+			done := cached.flight == nil
+			cached.mutex.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		credential, err = cached.GetCredential(context.Background())
+		utils.AssertNil(t, err)
+		utils.AssertEqual(t, "ak1", credential.AccessKeyId)
+		waitRefresh()
+	}
+	utils.AssertEqual(t, int32(2), atomic.LoadInt32(&provider.calls))
+	cached.mutex.Lock()
+	utils.AssertEqual(t, 1, cached.failures)
+	cached.retryAt = time.Now()
+	cached.mutex.Unlock()
+	cached.GetCredential(context.Background())
+	waitRefresh()
+	utils.AssertEqual(t, int32(3), atomic.LoadInt32(&provider.calls))
+	cached.mutex.Lock()
+	utils.AssertEqual(t, 2, cached.failures)
+	cached.retryAt = time.Now()
+	cached.mutex.Unlock()
+	provider.fail = false
+	cached.GetCredential(context.Background())
+	waitRefresh()
+	credential, _ = cached.GetCredential(context.Background())
+	utils.AssertEqual(t, "ak4", credential.AccessKeyId)
+	utils.AssertEqual(t, 0, cached.failures)
+
+	utils.AssertEqual(t, time.Second, refreshBackoff(1))
+	utils.AssertEqual(t, 4*time.Second, refreshBackoff(3))
+	utils.AssertEqual(t, time.Minute, refreshBackoff(10))
+}
+
+func Test_DoRequestWaitsForCredentialWithinTimeout(t *testing.T) {
+	provider := &countingProvider{release: make(chan struct{})}
+	defer close(provider.release)
+	runtime := &RuntimeObject{
+		ReadTimeout: Int(30),
+		Signer:      &RPCSigner{Credentials: NewCachedCredentialsProvider(provider)},
+	}
+	start := time.Now()
+	_, err := DoRequest(NewRequest(), runtime)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+	utils.AssertEqual(t, true, time.Since(start) < time.Second)
+}
+
+func Test_SignerWithCredentialsProvider(t *testing.T) {
+	request := NewRequest()
+	signer := &RPCSigner{Credentials: NewStaticCredentialsProvider("providedak", "sk", "token")}
+	utils.AssertNil(t, signer.Sign(request, &SigningContext{Time: time.Now(), Nonce: "n"}))
+	utils.AssertEqual(t, "providedak", StringValue(request.Query["AccessKeyId"]))
+	utils.AssertEqual(t, "token", StringValue(request.Query["SecurityToken"]))
+
+	acs3 := &ACS3Signer{Credentials: &countingProvider{fail: true}}
+	err := acs3.Sign(NewRequest(), &SigningContext{Time: time.Now(), Nonce: "n"})
+	utils.AssertEqual(t, "provider failed", err.Error())
+}
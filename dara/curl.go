@@ -0,0 +1,121 @@
+package dara
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// ToCurl renders request as a cURL command with the default secrets redacted
+func ToCurl(request *Request) (string, error) {
+	return ToCurlWithRedactKeys(request, utils.DefaultRedactKeys)
+}
+
+// ToCurlWithRedactKeys renders request as a cURL command sending the same url,
+// method, headers and body as DoRequest with a zero RuntimeObject, with the
+// values of redactKeys masked: the query is form encoded and the header names
+// are kept as they are. ToCurlWithRuntime renders the command of another
+// RuntimeObject. A body which can not be rewound is replaced with an
+// in-memory copy.
+func ToCurlWithRedactKeys(request *Request, redactKeys []string) (string, error) {
+	return toCurl(request, redactKeys, "", "")
+}
+
+// ToCurlWithRuntime renders request as the cURL command of DoRequest sending it
+// with runtimeObject, with the default secrets redacted: the body is compressed,
+// the client token set and the request signed as DoRequest does, the query is
+// encoded and the header names cased as runtimeObject says. request is changed
+// the same way DoRequest changes it.
+func ToCurlWithRuntime(request *Request, runtimeObject *RuntimeObject) (string, error) {
+	if runtimeObject == nil {
+		runtimeObject = &RuntimeObject{}
+	}
+	headerCase := StringValue(runtimeObject.HeaderCase)
+	if err := checkHeaderCase(headerCase); err != nil {
+		return "", err
+	}
+	encoding := StringValue(runtimeObject.QueryEncoding)
+	if err := checkQueryEncoding(encoding); err != nil {
+		return "", err
+	}
+	if request.Method == nil {
+		request.Method = String("GET")
+	}
+	request.Domain = getRequestDomain(request)
+	if err := compressRequest(request, runtimeObject); err != nil {
+		return "", err
+	}
+	if err := signRequest(request, runtimeObject); err != nil {
+		return "", err
+	}
+	return toCurl(request, utils.DefaultRedactKeys, encoding, headerCase)
+}
+
+func toCurl(request *Request, redactKeys []string, encoding, headerCase string) (string, error) {
+	body, err := readBodyBytes(request)
+	if err != nil {
+		return "", err
+	}
+	method := "GET"
+	if request.Method != nil {
+		method = StringValue(request.Method)
+	}
+
+	redacted := *request
+	redacted.Query = redactQuery(request.Query, redactKeys)
+	redacted.extraQuery = make(map[string][]string, len(request.extraQuery))
+	for key, values := range request.extraQuery {
+		redacted.extraQuery[key] = values
+		if utils.ShouldRedact(key, redactKeys) {
+			redacted.extraQuery[key] = make([]string, len(values))
+			for i := range values {
+				redacted.extraQuery[key][i] = utils.RedactedValue
+			}
+		}
+	}
+	header := http.Header{}
+	setRequestHeaders(header, request, headerCase)
+	header = utils.RedactHeaders(header, redactKeys)
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{"curl", "-X", method, shellQuote(buildRequestURL(&redacted, encoding))}
+	for _, key := range keys {
+		for _, value := range header[key] {
+			parts = append(parts, "-H", shellQuote(key+": "+value))
+		}
+	}
+	if len(body) == 0 {
+		return strings.Join(parts, " "), nil
+	}
+	if utf8.Valid(body) {
+		text := utils.RedactBody(string(body), redactKeys)
+		parts = append(parts, "--data-binary", shellQuote(text))
+		return strings.Join(parts, " "), nil
+	}
+	parts = append(parts, "--data-binary", "@-")
+	return "echo " + base64.StdEncoding.EncodeToString(body) + " | base64 -d | " + strings.Join(parts, " "), nil
+}
+
+func redactQuery(query map[string]*string, redactKeys []string) map[string]*string {
+	result := make(map[string]*string, len(query))
+	for key, value := range query {
+		if value != nil && utils.ShouldRedact(key, redactKeys) {
+			result[key] = String(utils.RedactedValue)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func shellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,109 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_ToCurl(t *testing.T) {
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Protocol = String("HTTPS")
+	request.Port = Int(8443)
+	request.Pathname = String("/api")
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Headers["content-length"] = String("24")
+	request.Headers["Authorization"] = String("acs ak:sign")
+	request.Headers["x-acs-action"] = String("Run")
+	request.Query["Signature"] = String("abc")
+	request.Query["Name"] = String("it's")
+	request.Body = strings.NewReader(`{"AccessKeySecret":"sk"}`)
+
+	cmd, err := ToCurl(request)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `curl -X POST 'https://ecs.aliyuncs.com:8443/api?Name=it%27s&Signature=%2A%2A%2A%2A%2A%2A'`+
+		` -H 'Authorization: ******' -H 'Host: ecs.aliyuncs.com' -H 'x-acs-action: Run'`+
+		` --data-binary '{"AccessKeySecret":"******"}'`, cmd)
+	// the body is still readable by DoRequest
+	byt, err := ioutil.ReadAll(request.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"AccessKeySecret":"sk"}`, string(byt))
+
+	request = NewRequest()
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Headers["user-agent"] = String("tea")
+	request.Query["Signature"] = String("abc")
+	request.Body = ioutil.NopCloser(strings.NewReader("\xff\x00"))
+	cmd, err = ToCurlWithRedactKeys(request, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `echo /wA= | base64 -d | curl -X GET 'http://ecs.aliyuncs.com?Signature=abc' -H 'Host: ecs.aliyuncs.com'`+
+		` -H 'User-Agent: tea' --data-binary @-`, cmd)
+	byt, err = ioutil.ReadAll(request.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "\xff\x00", string(byt))
+
+	request.Body = nil
+	cmd, err = ToCurlWithRedactKeys(request, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `curl -X GET 'http://ecs.aliyuncs.com?Signature=abc' -H 'Host: ecs.aliyuncs.com' -H 'User-Agent: tea'`, cmd)
+	utils.AssertEqual(t, `'a'\''b'`, shellQuote("a'b"))
+}
+
+func Test_ToCurlWithRuntime(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var sent string
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			sent = req.URL.String()
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+	newCurlRequest := func() *Request {
+		request := NewRequest()
+		request.Headers["host"] = String("ecs.aliyuncs.com")
+		request.Headers["x-acs-action"] = String("Run")
+		request.Query["Name"] = String("a b*")
+		return request
+	}
+
+	// a zero runtime sends the query form encoded
+	cmd, err := ToCurlWithRuntime(newCurlRequest(), nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `curl -X GET 'http://ecs.aliyuncs.com?Name=a+b%2A' -H 'Host: ecs.aliyuncs.com' -H 'x-acs-action: Run'`, cmd)
+	_, err = DoRequest(newCurlRequest(), nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com?Name=a+b%2A", sent)
+	// so does ToCurl
+	cmd, err = ToCurl(newCurlRequest())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `curl -X GET 'http://ecs.aliyuncs.com?Name=a+b%2A' -H 'Host: ecs.aliyuncs.com' -H 'x-acs-action: Run'`, cmd)
+
+	runtime := &RuntimeObject{QueryEncoding: String(QueryEncodingRFC3986), HeaderCase: String(HeaderCaseCanonical)}
+	cmd, err = ToCurlWithRuntime(newCurlRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `curl -X GET 'http://ecs.aliyuncs.com?Name=a%20b%2A' -H 'Host: ecs.aliyuncs.com' -H 'X-Acs-Action: Run'`, cmd)
+	_, err = DoRequest(newCurlRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com?Name=a%20b%2A", sent)
+
+	// the request is signed like DoRequest signs it
+	request := newCurlRequest()
+	cmd, err = ToCurlWithRuntime(request, &RuntimeObject{
+		HeaderCase: String(HeaderCaseLowercase),
+		Signer:     &ACS3Signer{Credential: &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}},
+	})
+	utils.AssertNil(t, err)
+	utils.AssertContains(t, cmd, "-H 'authorization: ******'",
+		"-H 'x-acs-date: "+StringValue(request.Headers["x-acs-date"])+"'",
+		"-H 'x-acs-signature-nonce: "+StringValue(request.Headers["x-acs-signature-nonce"])+"'")
+
+	_, err = ToCurlWithRuntime(newCurlRequest(), &RuntimeObject{HeaderCase: String("upper")})
+	utils.AssertEqual(t, `dara: unsupported header case "upper"`, err.Error())
+	_, err = ToCurlWithRuntime(newCurlRequest(), &RuntimeObject{QueryEncoding: String("plain")})
+	utils.AssertNotNil(t, err)
+}
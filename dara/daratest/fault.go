@@ -0,0 +1,287 @@
+package daratest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alibabacloud-go/tea/dara"
+)
+
+var _ dara.HttpClient = (*FaultClient)(nil)
+
+// LatencyDistribution draws an injected latency
+type LatencyDistribution func(r *rand.Rand) time.Duration
+
+// FixedLatency always waits d
+func FixedLatency(d time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// UniformLatency waits between min and max
+func UniformLatency(min, max time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// NormalLatency waits a normally distributed duration, never less than 0
+func NormalLatency(mean, stddev time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		d := time.Duration(r.NormFloat64()*float64(stddev)) + mean
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+}
+
+// ExponentialLatency waits an exponentially distributed duration, which gives a long tail
+func ExponentialLatency(mean time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// FaultRule describes the faults injected into matching calls. Probabilities are within [0, 1].
+type FaultRule struct {
+	// Host and Operation scope the rule, empty matches any.
+	// The operation is the x-acs-action header or the Action query.
+	Host      string
+	Operation string
+
+	LatencyProbability float64
+	Latency            LatencyDistribution
+
+	// ResetProbability fails the call with a connection reset before it is sent
+	ResetProbability float64
+
+	// ErrorProbability replaces the response with one of ErrorStatus, 503 by default
+	ErrorProbability float64
+	ErrorStatus      []int
+
+	// TruncateProbability cuts the response body at a random offset
+	TruncateProbability float64
+
+	// SlowBodyProbability delivers the response body SlowBodyChunk bytes every SlowBodyInterval
+	SlowBodyProbability float64
+	SlowBodyChunk       int
+	SlowBodyInterval    time.Duration
+}
+
+// FaultClient wraps a dara.HttpClient and injects faults following its rules
+type FaultClient struct {
+	sync.Mutex
+	client        dara.HttpClient
+	rand          *rand.Rand
+	rules         []*FaultRule
+	disabledHosts map[string]bool
+	disabledOps   map[string]bool
+}
+
+// NewFaultClient wraps client. The same seed injects the same faults for the same calls.
+func NewFaultClient(client dara.HttpClient, seed int64, rules ...*FaultRule) *FaultClient {
+	return &FaultClient{
+		client:        client,
+		rand:          rand.New(rand.NewSource(seed)),
+		rules:         rules,
+		disabledHosts: make(map[string]bool),
+		disabledOps:   make(map[string]bool),
+	}
+}
+
+// AddRule appends a rule
+func (client *FaultClient) AddRule(rule *FaultRule) {
+	client.Lock()
+	defer client.Unlock()
+	client.rules = append(client.rules, rule)
+}
+
+// SetHostEnabled switches injection on or off for host
+func (client *FaultClient) SetHostEnabled(host string, enabled bool) {
+	client.Lock()
+	defer client.Unlock()
+	client.disabledHosts[strings.ToLower(host)] = !enabled
+}
+
+// SetOperationEnabled switches injection on or off for operation
+func (client *FaultClient) SetOperationEnabled(operation string, enabled bool) {
+	client.Lock()
+	defer client.Unlock()
+	client.disabledOps[operation] = !enabled
+}
+
+// faultPlan is what was decided for one call
+type faultPlan struct {
+	latency      time.Duration
+	reset        bool
+	status       int
+	truncateAt   float64
+	truncate     bool
+	slowBody     bool
+	slowChunk    int
+	slowInterval time.Duration
+}
+
+func (client *FaultClient) plan(host, operation string) *faultPlan {
+	client.Lock()
+	defer client.Unlock()
+	plan := new(faultPlan)
+	if client.disabledHosts[strings.ToLower(host)] || client.disabledOps[operation] {
+		return plan
+	}
+	for _, rule := range client.rules {
+		if rule.Host != "" && !strings.EqualFold(rule.Host, host) {
+			continue
+		}
+		if rule.Operation != "" && rule.Operation != operation {
+			continue
+		}
+		if rule.Latency != nil && client.hit(rule.LatencyProbability) {
+			plan.latency += rule.Latency(client.rand)
+		}
+		if client.hit(rule.ResetProbability) {
+			plan.reset = true
+		}
+		if client.hit(rule.ErrorProbability) {
+			plan.status = http.StatusServiceUnavailable
+			if len(rule.ErrorStatus) > 0 {
+				plan.status = rule.ErrorStatus[client.rand.Intn(len(rule.ErrorStatus))]
+			}
+		}
+		if client.hit(rule.TruncateProbability) {
+			plan.truncate = true
+			plan.truncateAt = client.rand.Float64()
+		}
+		if client.hit(rule.SlowBodyProbability) {
+			plan.slowBody = true
+			plan.slowChunk = rule.SlowBodyChunk
+			plan.slowInterval = rule.SlowBodyInterval
+		}
+	}
+	return plan
+}
+
+func (client *FaultClient) hit(probability float64) bool {
+	return probability > 0 && client.rand.Float64() < probability
+}
+
+func (client *FaultClient) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	operation := request.URL.Query().Get("Action")
+	for key, values := range request.Header {
+		if strings.EqualFold(key, "x-acs-action") && len(values) > 0 {
+			operation = values[0]
+		}
+	}
+	host := request.URL.Hostname()
+	plan := client.plan(host, operation)
+
+	if plan.latency > 0 {
+		timer := time.NewTimer(plan.latency)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+	if plan.reset {
+		if request.Body != nil {
+			request.Body.Close()
+		}
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	if plan.status != 0 {
+		if request.Body != nil {
+			request.Body.Close()
+		}
+		return faultResponse(request, plan.status), nil
+	}
+
+	response, err := client.client.Call(request, transport)
+	if err != nil {
+		return response, err
+	}
+	if plan.truncate {
+		byt, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		response.Body = ioutil.NopCloser(io.MultiReader(
+			bytes.NewReader(byt[:int(float64(len(byt))*plan.truncateAt)]),
+			&errorReader{err: io.ErrUnexpectedEOF},
+		))
+	}
+	if plan.slowBody {
+		response.Body = &slowReadCloser{
+			ReadCloser: response.Body,
+			chunk:      plan.slowChunk,
+			interval:   plan.slowInterval,
+		}
+	}
+	return response, nil
+}
+
+func faultResponse(request *http.Request, status int) *http.Response {
+	code := "ServiceUnavailable"
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if status == http.StatusTooManyRequests {
+		code = "Throttling"
+		header.Set("Retry-After", "1")
+	} else if status < http.StatusInternalServerError {
+		code = http.StatusText(status)
+	}
+	body := `{"Code":"` + code + `","Message":"injected fault"}`
+	return &http.Response{
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    status,
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+type errorReader struct {
+	err error
+}
+
+func (reader *errorReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
+
+// slowReadCloser returns at most chunk bytes per interval
+type slowReadCloser struct {
+	io.ReadCloser
+	chunk    int
+	interval time.Duration
+}
+
+func (reader *slowReadCloser) Read(p []byte) (int, error) {
+	chunk := reader.chunk
+	if chunk <= 0 {
+		chunk = 1
+	}
+	if len(p) > chunk {
+		p = p[:chunk]
+	}
+	time.Sleep(reader.interval)
+	return reader.ReadCloser.Read(p)
+}
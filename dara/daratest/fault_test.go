@@ -0,0 +1,129 @@
+package daratest
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/dara"
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newFaultTarget(t *testing.T) *MockClient {
+	client := NewMockClient(t)
+	client.On("", "/*").Reply(200, "0123456789")
+	return client
+}
+
+func doFault(client dara.HttpClient, action string) (*dara.Response, error) {
+	request := newRequest("GET", "/api")
+	request.Query["Action"] = dara.String(action)
+	return dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+}
+
+func Test_FaultClientReset(t *testing.T) {
+	target := newFaultTarget(t)
+	client := NewFaultClient(target, 1, &FaultRule{ResetProbability: 1})
+	_, err := doFault(client, "Describe")
+	opErr, ok := err.(*net.OpError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, syscall.ECONNRESET, opErr.Err)
+	utils.AssertCallCount(t, target, "", "/api", 0)
+
+	client.SetHostEnabled("ecs.aliyuncs.com", false)
+	resp, err := doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, dara.IntValue(resp.StatusCode))
+
+	client.SetHostEnabled("ecs.aliyuncs.com", true)
+	client.SetOperationEnabled("Describe", false)
+	_, err = doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	_, err = doFault(client, "Create")
+	utils.AssertNotNil(t, err)
+}
+
+func Test_FaultClientStatus(t *testing.T) {
+	client := NewFaultClient(newFaultTarget(t), 1, &FaultRule{
+		Operation:        "Create",
+		ErrorProbability: 1,
+		ErrorStatus:      []int{429},
+	})
+	resp, err := doFault(client, "Create")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 429, dara.IntValue(resp.StatusCode))
+	utils.AssertEqual(t, "1", dara.StringValue(resp.Headers["retry-after"]))
+	body, _ := resp.ReadBody()
+	utils.AssertEqual(t, `{"Code":"Throttling","Message":"injected fault"}`, string(body))
+
+	resp, err = doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, dara.IntValue(resp.StatusCode))
+
+	client.AddRule(&FaultRule{Host: "ecs.aliyuncs.com", Operation: "Describe", ErrorProbability: 1})
+	resp, err = doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 503, dara.IntValue(resp.StatusCode))
+}
+
+func Test_FaultClientBody(t *testing.T) {
+	client := NewFaultClient(newFaultTarget(t), 1, &FaultRule{TruncateProbability: 1})
+	resp, err := doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, "unexpected EOF", err.Error())
+
+	client = NewFaultClient(newFaultTarget(t), 1, &FaultRule{
+		SlowBodyProbability: 1,
+		SlowBodyChunk:       4,
+		SlowBodyInterval:    5 * time.Millisecond,
+	})
+	resp, err = doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	start := time.Now()
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "0123456789", string(body))
+	utils.AssertEqual(t, true, time.Since(start) >= 15*time.Millisecond)
+}
+
+func Test_FaultClientLatency(t *testing.T) {
+	client := NewFaultClient(newFaultTarget(t), 1, &FaultRule{
+		LatencyProbability: 1,
+		Latency:            FixedLatency(20 * time.Millisecond),
+	})
+	start := time.Now()
+	_, err := doFault(client, "Describe")
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, time.Since(start) >= 20*time.Millisecond)
+
+	req, _ := http.NewRequest("GET", "http://ecs.aliyuncs.com/api", nil)
+	client = NewFaultClient(newFaultTarget(t), 1, &FaultRule{
+		LatencyProbability: 1,
+		Latency:            FixedLatency(time.Second),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Call(req.WithContext(ctx), nil)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+}
+
+func Test_LatencyDistributions(t *testing.T) {
+	a := NewFaultClient(nil, 42)
+	b := NewFaultClient(nil, 42)
+	for _, dist := range []LatencyDistribution{
+		UniformLatency(time.Millisecond, 10*time.Millisecond),
+		NormalLatency(5*time.Millisecond, time.Millisecond),
+		ExponentialLatency(5 * time.Millisecond),
+	} {
+		d := dist(a.rand)
+		utils.AssertEqual(t, d, dist(b.rand))
+		utils.AssertEqual(t, true, d >= 0)
+	}
+	utils.AssertEqual(t, time.Millisecond, UniformLatency(time.Millisecond, time.Millisecond)(a.rand))
+	utils.AssertEqual(t, time.Duration(0), NormalLatency(-time.Second, 0)(a.rand))
+}
@@ -0,0 +1,279 @@
+// Package daratest provides fake dara.HttpClient implementations for testing SDK callers.
+package daratest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/dara"
+)
+
+var _ dara.HttpClient = (*MockClient)(nil)
+
+// MockClient is a dara.HttpClient that answers requests from registered routes
+type MockClient struct {
+	sync.Mutex
+	t      testing.TB
+	routes []*Route
+	calls  []*Call
+}
+
+// Call is a request received by MockClient
+type Call struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	// Route is the route which answered the call, nil if unmatched
+	Route *Route
+}
+
+// Route matches requests and describes the canned reply
+type Route struct {
+	method        string
+	pathPattern   string
+	queryMatchers []func(url.Values) bool
+	headMatchers  []func(http.Header) bool
+	status        int
+	header        http.Header
+	body          []byte
+	delay         time.Duration
+	err           error
+	times         int
+	calls         int
+}
+
+// NewMockClient creates a MockClient. Unmatched requests are reported to t
+// when t is not nil, and always fail with an error.
+func NewMockClient(t testing.TB) *MockClient {
+	return &MockClient{
+		t:      t,
+		routes: make([]*Route, 0),
+		calls:  make([]*Call, 0),
+	}
+}
+
+// On registers a route for method and a path.Match pattern. An empty method matches any method.
+func (client *MockClient) On(method, pathPattern string) *Route {
+	route := &Route{
+		method:      strings.ToUpper(method),
+		pathPattern: pathPattern,
+		status:      http.StatusOK,
+		header:      http.Header{},
+	}
+	client.Lock()
+	client.routes = append(client.routes, route)
+	client.Unlock()
+	return route
+}
+
+// WithQuery matches requests whose query key equals value
+func (route *Route) WithQuery(key, value string) *Route {
+	return route.WithQueryFunc(func(query url.Values) bool {
+		return query.Get(key) == value
+	})
+}
+
+// WithQueryFunc matches requests whose query satisfies fn
+func (route *Route) WithQueryFunc(fn func(query url.Values) bool) *Route {
+	route.queryMatchers = append(route.queryMatchers, fn)
+	return route
+}
+
+// WithHeader matches requests whose header key equals value
+func (route *Route) WithHeader(key, value string) *Route {
+	return route.WithHeaderFunc(func(header http.Header) bool {
+		for name, values := range header {
+			if strings.EqualFold(name, key) && len(values) > 0 && values[0] == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithHeaderFunc matches requests whose header satisfies fn
+func (route *Route) WithHeaderFunc(fn func(header http.Header) bool) *Route {
+	route.headMatchers = append(route.headMatchers, fn)
+	return route
+}
+
+// Reply sets the status code and body of the response
+func (route *Route) Reply(status int, body string) *Route {
+	route.status = status
+	route.body = []byte(body)
+	return route
+}
+
+// ReplyHeader adds a header to the response
+func (route *Route) ReplyHeader(key, value string) *Route {
+	route.header.Add(key, value)
+	return route
+}
+
+// ReplyError makes the route fail with err instead of responding
+func (route *Route) ReplyError(err error) *Route {
+	route.err = err
+	return route
+}
+
+// Delay waits d before replying, or until the request is cancelled
+func (route *Route) Delay(d time.Duration) *Route {
+	route.delay = d
+	return route
+}
+
+// Times limits the route to n matches. 0 means unlimited.
+func (route *Route) Times(n int) *Route {
+	route.times = n
+	return route
+}
+
+func (route *Route) match(request *http.Request, query url.Values) bool {
+	if route.method != "" && route.method != request.Method {
+		return false
+	}
+	if route.times > 0 && route.calls >= route.times {
+		return false
+	}
+	if ok, _ := path.Match(route.pathPattern, request.URL.Path); !ok {
+		return false
+	}
+	for _, fn := range route.queryMatchers {
+		if !fn(query) {
+			return false
+		}
+	}
+	for _, fn := range route.headMatchers {
+		if !fn(request.Header) {
+			return false
+		}
+	}
+	return true
+}
+
+func (client *MockClient) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		byt, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		body = byt
+	}
+	query := request.URL.Query()
+	call := &Call{
+		Method: request.Method,
+		Path:   request.URL.Path,
+		Query:  query,
+		Header: request.Header,
+		Body:   body,
+	}
+
+	client.Lock()
+	var route *Route
+	for _, value := range client.routes {
+		if value.match(request, query) {
+			route = value
+			route.calls++
+			break
+		}
+	}
+	call.Route = route
+	client.calls = append(client.calls, call)
+	client.Unlock()
+
+	if route == nil {
+		err := fmt.Errorf("daratest: unmatched request %s %s", request.Method, request.URL.RequestURI())
+		if client.t != nil {
+			client.t.Errorf("%s", err.Error())
+		}
+		return nil, err
+	}
+	if route.delay > 0 {
+		timer := time.NewTimer(route.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+	if route.err != nil {
+		return nil, route.err
+	}
+	header := http.Header{}
+	for key, values := range route.header {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    route.status,
+		Status:        strconv.Itoa(route.status) + " " + http.StatusText(route.status),
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(route.body)),
+		ContentLength: int64(len(route.body)),
+		Request:       request,
+	}, nil
+}
+
+// Calls returns a copy of the call log
+func (client *MockClient) Calls() []*Call {
+	client.Lock()
+	defer client.Unlock()
+	return append([]*Call(nil), client.calls...)
+}
+
+// CallCount returns how many calls matched method and the path.Match pattern.
+// An empty method matches any method.
+func (client *MockClient) CallCount(method, pathPattern string) int {
+	client.Lock()
+	defer client.Unlock()
+	count := 0
+	for _, call := range client.calls {
+		if method != "" && !strings.EqualFold(method, call.Method) {
+			continue
+		}
+		if ok, _ := path.Match(pathPattern, call.Path); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// Unmatched returns the calls no route answered
+func (client *MockClient) Unmatched() []*Call {
+	client.Lock()
+	defer client.Unlock()
+	result := make([]*Call, 0)
+	for _, call := range client.calls {
+		if call.Route == nil {
+			result = append(result, call)
+		}
+	}
+	return result
+}
+
+// AssertExpectations checks that every route limited by Times was called exactly that many times
+func (client *MockClient) AssertExpectations(t testing.TB) {
+	client.Lock()
+	defer client.Unlock()
+	for _, route := range client.routes {
+		if route.times > 0 && route.calls != route.times {
+			t.Errorf("daratest: %s %s was called %d times, expected %d", route.method, route.pathPattern, route.calls, route.times)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package daratest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/dara"
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+type recordT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, format)
+}
+
+func newRequest(method, pathname string) *dara.Request {
+	request := dara.NewRequest()
+	request.Method = dara.String(method)
+	request.Pathname = dara.String(pathname)
+	request.Headers["host"] = dara.String("ecs.aliyuncs.com")
+	return request
+}
+
+func Test_MockClient(t *testing.T) {
+	client := NewMockClient(t)
+	client.On("GET", "/regions").WithQuery("Action", "DescribeRegions").
+		Reply(200, `{"Regions":[]}`).ReplyHeader("x-acs-request-id", "id")
+	client.On("POST", "/instances/*").WithHeader("x-acs-action", "Stop").Reply(400, `{"Code":"Invalid"}`).Times(1)
+	client.On("", "/error").ReplyError(errors.New("connection reset"))
+
+	request := newRequest("GET", "/regions")
+	request.Query["Action"] = dara.String("DescribeRegions")
+	resp, err := dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 200, dara.IntValue(resp.StatusCode))
+	utils.AssertEqual(t, "id", dara.StringValue(resp.Headers["x-acs-request-id"]))
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"Regions":[]}`, string(body))
+
+	request = newRequest("POST", "/instances/i-1")
+	request.Headers["x-acs-action"] = dara.String("Stop")
+	request.Body = strings.NewReader("payload")
+	resp, err = dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 400, dara.IntValue(resp.StatusCode))
+
+	request = newRequest("DELETE", "/error")
+	_, err = dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+	utils.AssertEqual(t, "connection reset", err.Error())
+
+	calls := client.Calls()
+	utils.AssertEqual(t, 3, len(calls))
+	utils.AssertEqual(t, "payload", string(calls[1].Body))
+	utils.AssertEqual(t, "Stop", calls[1].Header["x-acs-action"][0])
+	utils.AssertCallCount(t, client, "GET", "/regions", 1)
+	utils.AssertCallCount(t, client, "POST", "/instances/*", 1)
+	utils.AssertCallCount(t, client, "", "/*", 2)
+	client.AssertExpectations(t)
+	utils.AssertEqual(t, 0, len(client.Unmatched()))
+}
+
+func Test_MockClientUnmatched(t *testing.T) {
+	rt := &recordT{TB: t}
+	client := NewMockClient(rt)
+	client.On("POST", "/once").Times(1)
+
+	request := newRequest("POST", "/once")
+	_, err := dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+	utils.AssertNil(t, err)
+	_, err = dara.DoRequest(request, &dara.RuntimeObject{HttpClient: client})
+	utils.AssertContains(t, err.Error(), "daratest: unmatched request POST /once")
+	utils.AssertEqual(t, 1, len(rt.errors))
+	utils.AssertEqual(t, 1, len(client.Unmatched()))
+
+	client.On("GET", "/twice").Times(2)
+	client.AssertExpectations(rt)
+	utils.AssertEqual(t, 2, len(rt.errors))
+}
+
+func Test_MockClientDelay(t *testing.T) {
+	client := NewMockClient(t)
+	client.On("GET", "/slow").Delay(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", "http://ecs.aliyuncs.com/slow", nil)
+	utils.AssertNil(t, err)
+	_, err = client.Call(req.WithContext(ctx), nil)
+	utils.AssertEqual(t, context.DeadlineExceeded, err)
+
+	client.On("GET", "/fast").Delay(time.Millisecond).Reply(204, "")
+	req, err = http.NewRequest("GET", "http://ecs.aliyuncs.com/fast", nil)
+	utils.AssertNil(t, err)
+	resp, err := client.Call(req, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "204 No Content", resp.Status)
+	byt, _ := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, 0, len(byt))
+}
+
+func Test_MockClientParallel(t *testing.T) {
+	client := NewMockClient(t)
+	client.On("GET", "/parallel").Reply(200, "ok")
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			t.Run("parallel", func(t *testing.T) {
+				t.Parallel()
+				resp, err := dara.DoRequest(newRequest("GET", "/parallel"), &dara.RuntimeObject{HttpClient: client})
+				utils.AssertNil(t, err)
+				utils.AssertEqual(t, 200, dara.IntValue(resp.StatusCode))
+			})
+		}
+	})
+	utils.AssertCallCount(t, client, "GET", "/parallel", 10)
+}
@@ -0,0 +1,428 @@
+package dara
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// DefaultDownloadPartSize is the number of bytes fetched by each range request
+const DefaultDownloadPartSize int64 = 8 * 1024 * 1024
+
+// DownloadOptions controls how DownloadFile fetches an object
+type DownloadOptions struct {
+	// PartSize is the number of bytes fetched by each range request
+	PartSize int64
+	// Parallel is the number of ranges fetched at the same time
+	Parallel int
+	// CheckpointPath records the finished ranges so a failed download can be resumed
+	CheckpointPath string
+	// Checksum is the algorithm used to verify the file: md5, crc64 or sha256
+	Checksum string
+	// ExpectedChecksum is the hex, base64 or (crc64) decimal checksum of the object
+	ExpectedChecksum string
+	// ChecksumHeader names the response header holding the expected checksum
+	ChecksumHeader string
+}
+
+// downloadCheckpoint is the file format of a download checkpoint
+type downloadCheckpoint struct {
+	Path     string `json:"path"`
+	ETag     string `json:"etag,omitempty"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"partSize"`
+	Parts    []bool `json:"parts"`
+}
+
+type downloader struct {
+	sync.Mutex
+	request    *Request
+	runtime    *RuntimeObject
+	dest       *DaraFile
+	options    *DownloadOptions
+	checkpoint *downloadCheckpoint
+	listener   utils.ProgressListener
+	interval   time.Duration
+	published  time.Time
+	consumed   int64
+	pending    int64
+	total      int64
+	err        error
+}
+
+// DownloadFile downloads the object addressed by request into dest with Range
+// requests. The finished ranges are saved to options.CheckpointPath so calling
+// DownloadFile again after a failure only fetches the missing ranges.
+func DownloadFile(request *Request, runtime *RuntimeObject, dest *DaraFile, options *DownloadOptions) (err error) {
+	if runtime == nil {
+		runtime = &RuntimeObject{}
+	}
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	if options.Checksum != "" {
+		if _, err = newChecksumHash(options.Checksum); err != nil {
+			return
+		}
+	}
+	// the listener is notified once for the whole file, not for each range,
+	// and the ranges are written as stored whatever their content-encoding
+	partRuntime := *runtime
+	partRuntime.Listener = nil
+	partRuntime.Tracker = nil
+	partRuntime.DisableResponseDecompression = Bool(true)
+	d := &downloader{
+		request:  request,
+		runtime:  &partRuntime,
+		dest:     dest,
+		options:  options,
+		listener: runtime.Listener,
+		interval: time.Duration(IntValue(runtime.ProgressInterval)) * time.Millisecond,
+	}
+
+	probe, err := d.fetch(0, 0, "")
+	if err != nil {
+		return
+	}
+	expected := options.ExpectedChecksum
+	if expected == "" && options.ChecksumHeader != "" {
+		expected = StringValue(probe.Headers[strings.ToLower(options.ChecksumHeader)])
+	}
+	switch IntValue(probe.StatusCode) {
+	case http.StatusOK:
+		// the server ignores Range, the probe carries the whole object
+		return d.downloadWhole(probe, expected)
+	case http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		probe.Body.Close()
+		d.total, err = parseContentRangeSize(StringValue(probe.Headers["content-range"]))
+		if err != nil {
+			return
+		}
+	default:
+		return unexpectedStatusError(probe, "bytes=0-0")
+	}
+
+	d.checkpoint = d.loadCheckpoint(StringValue(probe.Headers["etag"]))
+	for index, done := range d.checkpoint.Parts {
+		if done {
+			d.consumed += d.partEnd(index) - int64(index)*d.checkpoint.PartSize
+		}
+	}
+	utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferStartedEvent, d.consumed, d.total, 0))
+	defer func() {
+		if err != nil {
+			utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferFailedEvent, d.consumed, d.total, 0))
+		}
+	}()
+
+	pending := make(chan int, len(d.checkpoint.Parts))
+	for index, done := range d.checkpoint.Parts {
+		if !done {
+			pending <- index
+		}
+	}
+	close(pending)
+	parallel := options.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range pending {
+				if d.failed() {
+					return
+				}
+				if err := d.downloadPart(index); err != nil {
+					d.fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err = d.err; err != nil {
+		return
+	}
+
+	if err = d.verify(expected); err != nil {
+		d.removeCheckpoint()
+		return
+	}
+	d.removeCheckpoint()
+	d.flushProgress()
+	utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferCompletedEvent, d.consumed, d.total, 0))
+	return
+}
+
+// fetch requests the bytes between start and end inclusive
+func (d *downloader) fetch(start, end int64, etag string) (*Response, error) {
+	request := &Request{
+		Protocol: d.request.Protocol,
+		Port:     d.request.Port,
+		Method:   d.request.Method,
+		Pathname: d.request.Pathname,
+		Domain:   d.request.Domain,
+		Headers:  make(map[string]*string, len(d.request.Headers)+2),
+		Query:    make(map[string]*string, len(d.request.Query)),
+	}
+	for key, value := range d.request.Headers {
+		request.Headers[key] = value
+	}
+	for key, value := range d.request.Query {
+		request.Query[key] = value
+	}
+	request.extraHeaders = d.request.extraHeaders
+	request.extraQuery = d.request.extraQuery
+	request.Headers["range"] = String(fmt.Sprintf("bytes=%d-%d", start, end))
+	if etag != "" {
+		request.Headers["if-match"] = String(etag)
+	}
+	return DoRequest(request, d.runtime)
+}
+
+// downloadWhole writes a response which is not ranged into dest
+func (d *downloader) downloadWhole(response *Response, expected string) (err error) {
+	defer response.Body.Close()
+	d.total = -1
+	if length, err := strconv.ParseInt(StringValue(response.Headers["content-length"]), 10, 64); err == nil {
+		d.total = length
+	}
+	utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferStartedEvent, 0, d.total, 0))
+	defer func() {
+		if err != nil {
+			utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferFailedEvent, d.consumed, d.total, 0))
+		}
+	}()
+	written, err := d.write(response.Body, 0, -1)
+	if err != nil {
+		return
+	}
+	if err = d.dest.Truncate(written); err != nil {
+		return
+	}
+	if d.total < 0 {
+		d.total = written
+	}
+	if err = d.verify(expected); err != nil {
+		return
+	}
+	d.flushProgress()
+	utils.PublishProgress(d.listener, utils.NewProgressEvent(utils.TransferCompletedEvent, d.consumed, d.total, 0))
+	return
+}
+
+func (d *downloader) downloadPart(index int) error {
+	start := int64(index) * d.checkpoint.PartSize
+	end := d.partEnd(index)
+	rangeValue := fmt.Sprintf("bytes=%d-%d", start, end-1)
+	response, err := d.fetch(start, end-1, d.checkpoint.ETag)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if IntValue(response.StatusCode) != http.StatusPartialContent {
+		return unexpectedStatusError(response, rangeValue)
+	}
+	written, err := d.write(response.Body, start, end-start)
+	if err != nil {
+		return err
+	}
+	if written != end-start {
+		return fmt.Errorf("dara: range %s returned %d bytes: %v", rangeValue, written, io.ErrUnexpectedEOF)
+	}
+	return d.finishPart(index)
+}
+
+// write copies body into dest at offset, reading at most limit bytes when limit is not negative
+func (d *downloader) write(body io.Reader, offset, limit int64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	written := int64(0)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if limit >= 0 && written+int64(n) > limit {
+				return written, fmt.Errorf("dara: response body is longer than %d bytes", limit)
+			}
+			if _, werr := d.dest.WriteAt(buf[:n], offset+written); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+			d.progress(int64(n))
+		}
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
+
+// partEnd returns the offset following the last byte of part index
+func (d *downloader) partEnd(index int) int64 {
+	end := int64(index+1) * d.checkpoint.PartSize
+	if end > d.checkpoint.Size {
+		end = d.checkpoint.Size
+	}
+	return end
+}
+
+func (d *downloader) progress(n int64) {
+	d.Lock()
+	defer d.Unlock()
+	d.consumed += n
+	d.pending += n
+	now := time.Now()
+	if d.interval > 0 && now.Sub(d.published) < d.interval {
+		return
+	}
+	event := utils.NewProgressEvent(utils.TransferDataEvent, d.consumed, d.total, d.pending)
+	d.published = now
+	d.pending = 0
+	utils.PublishProgress(d.listener, event)
+}
+
+// flushProgress publishes the bytes held back by the progress interval
+func (d *downloader) flushProgress() {
+	d.Lock()
+	defer d.Unlock()
+	if d.pending == 0 {
+		return
+	}
+	event := utils.NewProgressEvent(utils.TransferDataEvent, d.consumed, d.total, d.pending)
+	d.pending = 0
+	utils.PublishProgress(d.listener, event)
+}
+
+func (d *downloader) fail(err error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *downloader) failed() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.err != nil
+}
+
+// verify compares the size and the checksum of dest with the object
+func (d *downloader) verify(expected string) error {
+	length, err := d.dest.Length()
+	if err != nil {
+		return err
+	}
+	if length != d.total {
+		return fmt.Errorf("dara: downloaded file has %d bytes, expected %d", length, d.total)
+	}
+	if d.options.Checksum == "" || expected == "" {
+		return nil
+	}
+	hash, err := newChecksumHash(d.options.Checksum)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(hash, io.NewSectionReader(d.dest, 0, length)); err != nil {
+		return err
+	}
+	if sum := hash.Sum(nil); !checksumMatches(sum, expected) {
+		err := &IntegrityError{
+			Algorithm: strings.ToLower(d.options.Checksum),
+			Expected:  expected,
+			Actual:    formatChecksum(d.options.Checksum, sum),
+		}
+		if d.options.ExpectedChecksum == "" {
+			err.Header = d.options.ChecksumHeader
+		}
+		return err
+	}
+	return nil
+}
+
+// loadCheckpoint returns the saved checkpoint when it still describes the
+// object and dest, a new one otherwise.
+func (d *downloader) loadCheckpoint(etag string) *downloadCheckpoint {
+	partSize := d.options.PartSize
+	if partSize <= 0 {
+		partSize = DefaultDownloadPartSize
+	}
+	count := int((d.total + partSize - 1) / partSize)
+	if d.options.CheckpointPath != "" {
+		checkpoint := new(downloadCheckpoint)
+		byt, err := ioutil.ReadFile(d.options.CheckpointPath)
+		if err == nil && json.Unmarshal(byt, checkpoint) == nil &&
+			checkpoint.Path == d.dest.Path() && checkpoint.ETag == etag && checkpoint.Size == d.total &&
+			checkpoint.PartSize == partSize && len(checkpoint.Parts) == count {
+			if length, err := d.dest.Length(); err == nil && length == d.total {
+				return checkpoint
+			}
+		}
+	}
+	d.dest.Truncate(d.total)
+	return &downloadCheckpoint{
+		Path:     d.dest.Path(),
+		ETag:     etag,
+		Size:     d.total,
+		PartSize: partSize,
+		Parts:    make([]bool, count),
+	}
+}
+
+func (d *downloader) finishPart(index int) error {
+	d.Lock()
+	defer d.Unlock()
+	d.checkpoint.Parts[index] = true
+	if d.options.CheckpointPath == "" {
+		return nil
+	}
+	byt, err := json.Marshal(d.checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := d.options.CheckpointPath + ".tmp"
+	if err = ioutil.WriteFile(tmp, byt, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.options.CheckpointPath)
+}
+
+func (d *downloader) removeCheckpoint() {
+	if d.options.CheckpointPath != "" {
+		os.Remove(d.options.CheckpointPath)
+	}
+}
+
+// parseContentRangeSize returns the complete length of a Content-Range header
+func parseContentRangeSize(contentRange string) (int64, error) {
+	index := strings.LastIndex(contentRange, "/")
+	if index == -1 {
+		return 0, fmt.Errorf("dara: invalid Content-Range %q", contentRange)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(contentRange[index+1:]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dara: invalid Content-Range %q", contentRange)
+	}
+	return size, nil
+}
+
+func unexpectedStatusError(response *Response, rangeValue string) error {
+	response.Body.Close()
+	return NewSDKError(map[string]interface{}{
+		"code":       IntValue(response.StatusCode),
+		"statusCode": IntValue(response.StatusCode),
+		"message":    fmt.Sprintf("dara: unexpected status %s downloading %s", StringValue(response.StatusMessage), rangeValue),
+	})
+}
@@ -0,0 +1,282 @@
+package dara
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// rangeServer serves payload honoring the Range header
+type rangeServer struct {
+	sync.Mutex
+	payload   []byte
+	etag      string
+	ignore    bool
+	failRange string
+	ranges    []string
+}
+
+func (server *rangeServer) Call(req *http.Request, transport *http.Transport) (*http.Response, error) {
+	server.Lock()
+	defer server.Unlock()
+	rangeValue := strings.Join(foldValues(req.Header, "range"), ",")
+	server.ranges = append(server.ranges, rangeValue)
+	if server.failRange != "" && rangeValue == server.failRange {
+		server.failRange = ""
+		return nil, errors.New("connection reset")
+	}
+	header := http.Header{}
+	header.Set("ETag", server.etag)
+	header.Set("x-oss-hash-crc64ecma", strconv.FormatUint(crc64.Checksum(server.payload, crc64Table), 10))
+	if server.ignore || rangeValue == "" {
+		header.Set("Content-Length", strconv.Itoa(len(server.payload)))
+		return &http.Response{StatusCode: 200, Status: "200 OK", Header: header,
+			Body: ioutil.NopCloser(bytes.NewReader(server.payload))}, nil
+	}
+	if match := strings.Join(foldValues(req.Header, "if-match"), ","); match != "" && match != server.etag {
+		return &http.Response{StatusCode: 412, Status: "412 Precondition Failed", Header: header,
+			Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}
+	var start, end int
+	fmt.Sscanf(rangeValue, "bytes=%d-%d", &start, &end)
+	if start >= len(server.payload) {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", len(server.payload)))
+		return &http.Response{StatusCode: 416, Status: "416 Requested Range Not Satisfiable", Header: header,
+			Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}
+	if end >= len(server.payload) {
+		end = len(server.payload) - 1
+	}
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(server.payload)))
+	return &http.Response{StatusCode: 206, Status: "206 Partial Content", Header: header,
+		Body: ioutil.NopCloser(bytes.NewReader(server.payload[start : end+1]))}, nil
+}
+
+func (server *rangeServer) requested() []string {
+	server.Lock()
+	defer server.Unlock()
+	return append([]string(nil), server.ranges...)
+}
+
+func newDownloadRequest() *Request {
+	request := NewRequest()
+	request.Headers["host"] = String("bucket.example.com")
+	request.Pathname = String("/object")
+	return request
+}
+
+func newPayload(size int) []byte {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	return payload
+}
+
+func Test_DownloadFileParallel(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := newPayload(1000)
+	sum := md5.Sum(payload)
+	server := &rangeServer{payload: payload, etag: `"v1"`}
+	listener := &recordListener{}
+	dest := NewDaraFile(filepath.Join(tempDir, "object"))
+	defer dest.Close()
+	runtime := &RuntimeObject{HttpClient: server, Listener: listener}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, &DownloadOptions{
+		PartSize:         100,
+		Parallel:         4,
+		Checksum:         ChecksumMD5,
+		ExpectedChecksum: hex.EncodeToString(sum[:]),
+	})
+	utils.AssertNil(t, err)
+	byt, err := ioutil.ReadFile(dest.Path())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, bytes.Equal(payload, byt))
+	// one probe and ten ranges
+	utils.AssertEqual(t, 11, len(server.requested()))
+
+	consumed := int64(0)
+	for _, event := range listener.dataEvents() {
+		consumed += event.RwBytes
+		utils.AssertEqual(t, int64(1000), event.TotalBytes)
+	}
+	utils.AssertEqual(t, int64(1000), consumed)
+	listener.Lock()
+	last := listener.events[len(listener.events)-1]
+	listener.Unlock()
+	utils.AssertEqual(t, utils.TransferCompletedEvent, last.EventType)
+	utils.AssertEqual(t, int64(1000), last.ConsumedBytes)
+}
+
+func Test_DownloadFileResume(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := newPayload(450)
+	server := &rangeServer{payload: payload, etag: `"v1"`, failRange: "bytes=200-299"}
+	dest := NewDaraFile(filepath.Join(tempDir, "object"))
+	defer dest.Close()
+	options := &DownloadOptions{
+		PartSize:       100,
+		CheckpointPath: filepath.Join(tempDir, "object.checkpoint"),
+		Checksum:       ChecksumCRC64,
+		ChecksumHeader: "x-oss-hash-crc64ecma",
+	}
+	runtime := &RuntimeObject{HttpClient: server}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, options)
+	utils.AssertNotNil(t, err)
+	utils.AssertEqual(t, "connection reset", err.Error())
+	exists, _ := Exists(options.CheckpointPath)
+	utils.AssertEqual(t, true, exists)
+
+	server.ranges = nil
+	err = DownloadFile(newDownloadRequest(), runtime, dest, options)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "bytes=0-0,bytes=200-299,bytes=300-399,bytes=400-449", strings.Join(server.requested(), ","))
+	byt, err := ioutil.ReadFile(dest.Path())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, bytes.Equal(payload, byt))
+	exists, _ = Exists(options.CheckpointPath)
+	utils.AssertEqual(t, false, exists)
+
+	// a changed object invalidates the checkpoint
+	server.failRange = "bytes=100-199"
+	server.ranges = nil
+	err = DownloadFile(newDownloadRequest(), runtime, dest, options)
+	utils.AssertNotNil(t, err)
+	server.etag = `"v2"`
+	server.ranges = nil
+	err = DownloadFile(newDownloadRequest(), runtime, dest, options)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 6, len(server.requested()))
+}
+
+func Test_DownloadFileVerify(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	server := &rangeServer{payload: newPayload(300), etag: `"v1"`}
+	dest := NewDaraFile(filepath.Join(tempDir, "object"))
+	defer dest.Close()
+	runtime := &RuntimeObject{HttpClient: server}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, &DownloadOptions{
+		PartSize:         128,
+		Checksum:         ChecksumSHA256,
+		ExpectedChecksum: "00",
+	})
+	utils.AssertNotNil(t, err)
+	integrityErr, ok := err.(*IntegrityError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "sha256", integrityErr.Algorithm)
+	utils.AssertEqual(t, "00", integrityErr.Expected)
+
+	err = DownloadFile(newDownloadRequest(), runtime, dest, &DownloadOptions{Checksum: "sha1"})
+	utils.AssertEqual(t, `dara: unsupported checksum algorithm "sha1"`, err.Error())
+
+	notFound := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 404, Status: "404 Not Found", Header: http.Header{},
+			Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}
+	runtime = &RuntimeObject{HttpClient: &stubClient{handler: notFound}}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, nil)
+	utils.AssertNotNil(t, err)
+	utils.AssertEqual(t, 404, IntValue(err.(*SDKError).StatusCode))
+}
+
+func Test_DownloadFileWithoutRange(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := newPayload(300)
+	path := filepath.Join(tempDir, "object")
+	utils.AssertNil(t, ioutil.WriteFile(path, newPayload(500), 0644))
+	server := &rangeServer{payload: payload, ignore: true}
+	dest := NewDaraFile(path)
+	defer dest.Close()
+	runtime := &RuntimeObject{HttpClient: server}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, &DownloadOptions{PartSize: 100, Parallel: 2})
+	utils.AssertNil(t, err)
+	byt, err := ioutil.ReadFile(path)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, bytes.Equal(payload, byt))
+	utils.AssertEqual(t, 1, len(server.requested()))
+
+	empty := &rangeServer{payload: []byte{}}
+	runtime = &RuntimeObject{HttpClient: empty}
+	err = DownloadFile(newDownloadRequest(), runtime, dest, nil)
+	utils.AssertNil(t, err)
+	length, _ := dest.Length()
+	utils.AssertEqual(t, int64(0), length)
+}
+
+func Test_DownloadFileEncodedObject(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// the object is stored gzipped, like static assets often are
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(strings.Repeat("static asset ", 50)))
+	writer.Close()
+	stored := buf.Bytes()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", EncodingGzip)
+		http.ServeContent(w, r, "asset.js", time.Time{}, bytes.NewReader(stored))
+	}))
+	defer server.Close()
+
+	request := newDownloadRequest()
+	request.Headers["host"] = String(strings.TrimPrefix(server.URL, "http://"))
+	dest := NewDaraFile(filepath.Join(tempDir, "asset.js"))
+	defer dest.Close()
+	err = DownloadFile(request, nil, dest, &DownloadOptions{PartSize: 16, Parallel: 2})
+	utils.AssertNil(t, err)
+	byt, err := ioutil.ReadFile(dest.Path())
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, bytes.Equal(stored, byt))
+
+	// a range is not decoded on its own
+	request = newDownloadRequest()
+	request.Headers["host"] = String(strings.TrimPrefix(server.URL, "http://"))
+	request.Headers["Range"] = String("bytes=0-9")
+	response, err := DoRequest(request, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 206, IntValue(response.StatusCode))
+	utils.AssertEqual(t, EncodingGzip, StringValue(response.Headers["content-encoding"]))
+	byt, err = response.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, bytes.Equal(stored[:10], byt))
+}
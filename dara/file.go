@@ -1,7 +1,9 @@
 package dara
 
 import (
+	"io"
 	"os"
+	"sync"
 )
 
 // File struct to represent the file
@@ -10,6 +12,7 @@ type DaraFile struct {
 	fileInfo os.FileInfo
 	file     *os.File
 	position int64
+	mutex    sync.Mutex
 }
 
 // NewFile creates a new instance of File
@@ -63,12 +66,8 @@ func (tf *DaraFile) Length() (int64, error) {
 
 // Read reads a specified number of bytes from the file
 func (tf *DaraFile) Read(size int) ([]byte, error) {
-	if tf.file == nil {
-		file, err := os.OpenFile(tf.path, os.O_RDWR|os.O_CREATE, 0755)
-		if err != nil {
-			return nil, err
-		}
-		tf.file = file
+	if _, err := tf.openFile(); err != nil {
+		return nil, err
 	}
 
 	fileInfo, err := tf.file.Stat()
@@ -101,23 +100,82 @@ func (tf *DaraFile) Read(size int) ([]byte, error) {
 
 // Write writes data to the file
 func (tf *DaraFile) Write(data []byte) error {
+	if _, err := tf.openFile(); err != nil {
+		return err
+	}
+
+	_, err := tf.file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	tf.fileInfo, err = os.Stat(tf.path) // Update fileInfo after write
+	return err
+}
+
+// openFile opens the file for reading and writing once
+func (tf *DaraFile) openFile() (*os.File, error) {
+	tf.mutex.Lock()
+	defer tf.mutex.Unlock()
 	if tf.file == nil {
 		file, err := os.OpenFile(tf.path, os.O_RDWR|os.O_CREATE, 0755)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		tf.file = file
 	}
+	return tf.file, nil
+}
 
-	_, err := tf.file.Write(data)
+// ReadAt reads len(p) bytes at offset off, DaraFile is an io.ReaderAt
+func (tf *DaraFile) ReadAt(p []byte, off int64) (int, error) {
+	file, err := tf.openFile()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return file.ReadAt(p, off)
+}
 
-	tf.fileInfo, err = os.Stat(tf.path) // Update fileInfo after write
+// WriteAt writes p at offset off, DaraFile is an io.WriterAt
+func (tf *DaraFile) WriteAt(p []byte, off int64) (int, error) {
+	file, err := tf.openFile()
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.WriteAt(p, off)
+	tf.mutex.Lock()
+	tf.fileInfo = nil
+	tf.mutex.Unlock()
+	return n, err
+}
+
+// Truncate changes the size of the file
+func (tf *DaraFile) Truncate(size int64) error {
+	file, err := tf.openFile()
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(size)
+	tf.mutex.Lock()
+	tf.fileInfo = nil
+	tf.mutex.Unlock()
 	return err
 }
 
+// Body returns a reader over the whole file to use as Request.Body, its
+// length is known so the request is not sent chunked
+func (tf *DaraFile) Body() (*io.SectionReader, error) {
+	file, err := tf.openFile()
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(file, 0, info.Size()), nil
+}
+
 // Close closes the file
 func (tf *DaraFile) Close() error {
 	if tf.file == nil {
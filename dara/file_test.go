@@ -181,3 +181,71 @@ func TestCreateReadWriteStream(t *testing.T) {
 		t.Fatalf("expected %q but got %q", originalContent, string(data))
 	}
 }
+
+// TestReadAtWriteAt tests the ReadAt, WriteAt and Truncate methods
+func TestReadAtWriteAt(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "testDir")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tf := NewDaraFile(filepath.Join(tempDir, "test.txt"))
+	defer tf.Close()
+	if _, err := tf.WriteAt([]byte("World"), 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := tf.WriteAt([]byte("Hello, "), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	length, _ := tf.Length()
+	if length != 12 {
+		t.Errorf("expected length 12, got %d", length)
+	}
+
+	buf := make([]byte, 5)
+	if _, err := tf.ReadAt(buf, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(buf) != "World" {
+		t.Errorf("expected World, got %s", string(buf))
+	}
+
+	if err := tf.Truncate(5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	length, _ = tf.Length()
+	if length != 5 {
+		t.Errorf("expected length 5, got %d", length)
+	}
+	if _, err := tf.ReadAt(buf, 5); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// TestBody tests the Body method
+func TestBody(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "testDir")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "test.txt")
+	if err := ioutil.WriteFile(path, []byte("Hello, World"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	tf := NewDaraFile(path)
+	defer tf.Close()
+	body, err := tf.Body()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body.Size() != 12 {
+		t.Errorf("expected size 12, got %d", body.Size())
+	}
+	data, _ := ioutil.ReadAll(body)
+	if string(data) != "Hello, World" {
+		t.Errorf("expected Hello, World, got %s", string(data))
+	}
+}
@@ -162,6 +162,24 @@ func (f *FileFormReader) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
+// length returns the number of bytes left to read, -1 when a file has an unknown length
+func (f *FileFormReader) length() int64 {
+	total := bodyLength(f.formField)
+	if total < 0 {
+		return -1
+	}
+	for i := f.index; i < len(f.formFiles); i++ {
+		for _, reader := range []io.Reader{f.formFiles[i].StartField, f.formFiles[i].File, f.formFiles[i].EndField} {
+			length := bodyLength(reader)
+			if length < 0 {
+				return -1
+			}
+			total += length
+		}
+	}
+	return total
+}
+
 func ToFormString(a map[string]interface{}) string {
 	if a == nil {
 		return ""
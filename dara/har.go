@@ -0,0 +1,346 @@
+package dara
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// HAR is the root of a HAR 1.2 document
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+}
+
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARNameValue `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings are in milliseconds, -1 when the phase did not happen
+type HARTimings struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder is a HttpClient which records the calls of client as HAR entries
+type HARRecorder struct {
+	sync.Mutex
+	client HttpClient
+	// RedactKeys lists the header, query and body fields masked in entries
+	RedactKeys []string
+	entries    []*HAREntry
+}
+
+// NewHARRecorder wraps client, the pooled client of the RuntimeObject is used
+// when it is nil. The response body of an entry is filled in once the caller
+// reads the body to its end or closes it.
+func NewHARRecorder(client HttpClient) *HARRecorder {
+	return &HARRecorder{
+		client:     client,
+		RedactKeys: utils.DefaultRedactKeys,
+		entries:    make([]*HAREntry, 0),
+	}
+}
+
+// harTrace collects the phase timestamps of one call
+type harTrace struct {
+	sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, wroteRequest     time.Time
+	firstByte                 time.Time
+}
+
+func (trace *harTrace) set(field *time.Time) {
+	trace.Lock()
+	*field = time.Now()
+	trace.Unlock()
+}
+
+func (trace *harTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { trace.set(&trace.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { trace.set(&trace.dnsDone) },
+		ConnectStart:         func(string, string) { trace.set(&trace.connectStart) },
+		ConnectDone:          func(string, string, error) { trace.set(&trace.connectDone) },
+		TLSHandshakeStart:    func() { trace.set(&trace.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { trace.set(&trace.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { trace.set(&trace.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { trace.set(&trace.wroteRequest) },
+		GotFirstResponseByte: func() { trace.set(&trace.firstByte) },
+	}
+}
+
+func (recorder *HARRecorder) Call(request *http.Request, transport *http.Transport) (*http.Response, error) {
+	reqBody, err := drainBody(&request.Body)
+	if err != nil {
+		return nil, err
+	}
+	trace := new(harTrace)
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace.clientTrace()))
+	client := recorder.client
+	if client == nil {
+		client = defaultClientOf(request, transport)
+	}
+
+	start := time.Now()
+	response, err := client.Call(request, transport)
+	if err != nil {
+		return nil, err
+	}
+	headersDone := time.Now()
+	harRequest := recorder.harRequest(request, reqBody)
+	entry := recorder.harEntry(start, headersDone, headersDone, trace, harRequest, response, nil)
+	recorder.Lock()
+	index := len(recorder.entries)
+	recorder.entries = append(recorder.entries, entry)
+	recorder.Unlock()
+	if response.Body == nil || response.Body == http.NoBody {
+		return response, nil
+	}
+	// the body is copied into the entry as the caller reads it, so streams are not held back
+	response.Body = &harBody{ReadCloser: response.Body, done: func(body []byte) {
+		entry := recorder.harEntry(start, headersDone, time.Now(), trace, harRequest, response, body)
+		recorder.Lock()
+		recorder.entries[index] = entry
+		recorder.Unlock()
+	}}
+	return response, nil
+}
+
+// harEntry builds the entry of a call started at start whose response headers
+// arrived at headersDone and whose body was read at end
+func (recorder *HARRecorder) harEntry(start, headersDone, end time.Time, trace *harTrace,
+	harRequest *HARRequest, response *http.Response, body []byte) *HAREntry {
+	trace.Lock()
+	timings := &HARTimings{
+		DNS:     harDuration(trace.dnsStart, trace.dnsDone),
+		Connect: harDuration(trace.connectStart, trace.connectDone),
+		SSL:     harDuration(trace.tlsStart, trace.tlsDone),
+		Send:    0,
+		Wait:    harMillis(headersDone.Sub(start)),
+		Receive: harMillis(end.Sub(headersDone)),
+	}
+	if !trace.gotConn.IsZero() && !trace.wroteRequest.IsZero() {
+		timings.Send = harDuration(trace.gotConn, trace.wroteRequest)
+		if !trace.firstByte.IsZero() {
+			timings.Wait = harDuration(trace.wroteRequest, trace.firstByte)
+			timings.Receive = harMillis(end.Sub(trace.firstByte))
+		}
+	}
+	trace.Unlock()
+	return &HAREntry{
+		StartedDateTime: start.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Time:            harMillis(end.Sub(start)),
+		Request:         harRequest,
+		Response:        recorder.harResponse(response, body),
+		Timings:         timings,
+	}
+}
+
+// harBody copies a response body as it is read and gives the copy to done
+// once the body is read to its end or closed
+type harBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func(body []byte)
+	once sync.Once
+}
+
+func (body *harBody) Read(p []byte) (n int, err error) {
+	n, err = body.ReadCloser.Read(p)
+	body.buf.Write(p[:n])
+	if err == io.EOF {
+		body.finish()
+	}
+	return
+}
+
+func (body *harBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.finish()
+	return err
+}
+
+func (body *harBody) finish() {
+	body.once.Do(func() { body.done(body.buf.Bytes()) })
+}
+
+func (recorder *HARRecorder) harRequest(request *http.Request, body []byte) *HARRequest {
+	query := request.URL.Query()
+	for key := range query {
+		if utils.ShouldRedact(key, recorder.RedactKeys) {
+			query.Set(key, utils.RedactedValue)
+		}
+	}
+	requestURL := *request.URL
+	requestURL.RawQuery = query.Encode()
+	harRequest := &HARRequest{
+		Method:      request.Method,
+		URL:         requestURL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     make([]*HARNameValue, 0),
+		Headers:     harNameValues(utils.RedactHeaders(request.Header, recorder.RedactKeys)),
+		QueryString: harNameValues(query),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if len(body) > 0 {
+		harRequest.PostData = &HARPostData{
+			Text: utils.RedactBody(string(body), recorder.RedactKeys),
+		}
+		if values := foldValues(request.Header, "content-type"); len(values) > 0 {
+			harRequest.PostData.MimeType = values[0]
+		}
+	}
+	return harRequest
+}
+
+func (recorder *HARRecorder) harResponse(response *http.Response, body []byte) *HARResponse {
+	statusText := response.Status
+	if idx := strings.Index(statusText, " "); idx >= 0 {
+		statusText = statusText[idx+1:]
+	}
+	content := &HARContent{
+		Size:     int64(len(body)),
+		MimeType: response.Header.Get("Content-Type"),
+	}
+	if utf8.Valid(body) {
+		content.Text = utils.RedactBody(string(body), recorder.RedactKeys)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return &HARResponse{
+		Status:      response.StatusCode,
+		StatusText:  statusText,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     make([]*HARNameValue, 0),
+		Headers:     harNameValues(utils.RedactHeaders(response.Header, recorder.RedactKeys)),
+		Content:     content,
+		RedirectURL: response.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+// HAR returns the recorded entries as a HAR document
+func (recorder *HARRecorder) HAR() *HAR {
+	recorder.Lock()
+	defer recorder.Unlock()
+	return &HAR{
+		Log: &HARLog{
+			Version: "1.2",
+			Creator: &HARCreator{Name: "alibabacloud-go/tea", Version: "1.0"},
+			Entries: append([]*HAREntry(nil), recorder.entries...),
+		},
+	}
+}
+
+// WriteFile saves the recorded entries into a .har file
+func (recorder *HARRecorder) WriteFile(path string) error {
+	byt, err := json.MarshalIndent(recorder.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, byt, 0644)
+}
+
+func harNameValues(values map[string][]string) []*HARNameValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*HARNameValue, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range values[key] {
+			result = append(result, &HARNameValue{Name: key, Value: value})
+		}
+	}
+	return result
+}
+
+func harDuration(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return -1
+	}
+	return harMillis(end.Sub(start))
+}
+
+func harMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
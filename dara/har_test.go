@@ -0,0 +1,128 @@
+package dara
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_HARRecorder(t *testing.T) {
+	stub := &stubClient{
+		handler: func(req *http.Request) (*http.Response, error) {
+			time.Sleep(time.Millisecond)
+			if req.Method == "GET" {
+				return mockResponse(200, "\xff\x00", nil)
+			}
+			res, err := mockResponse(400, `{"Code":"Invalid","SecurityToken":"token"}`, nil)
+			res.Header.Set("Content-Type", "application/json")
+			res.Header.Set("Location", "https://ecs.aliyuncs.com/moved")
+			return res, err
+		},
+	}
+	recorder := NewHARRecorder(stub)
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Pathname = String("/api")
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	request.Headers["content-type"] = String("application/x-www-form-urlencoded")
+	request.Headers["authorization"] = String("acs ak:sign")
+	request.Query["Signature"] = String("abc")
+	request.Query["Action"] = String("Run")
+	request.Body = strings.NewReader("Action=Run&Signature=abc")
+	resp, err := DoRequest(request, &RuntimeObject{HttpClient: recorder})
+	utils.AssertNil(t, err)
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"Code":"Invalid","SecurityToken":"token"}`, string(body))
+
+	request.Method = String("GET")
+	request.Body = nil
+	resp, err = DoRequest(request, &RuntimeObject{HttpClient: recorder})
+	utils.AssertNil(t, err)
+	_, err = resp.ReadBody()
+	utils.AssertNil(t, err)
+
+	har := recorder.HAR()
+	utils.AssertEqual(t, "1.2", har.Log.Version)
+	utils.AssertEqual(t, 2, len(har.Log.Entries))
+	entry := har.Log.Entries[0]
+	utils.AssertEqual(t, "http://ecs.aliyuncs.com/api?Action=Run&Signature=%2A%2A%2A%2A%2A%2A", entry.Request.URL)
+	utils.AssertEqual(t, "Action=Run&Signature=******", entry.Request.PostData.Text)
+	utils.AssertEqual(t, "application/x-www-form-urlencoded", entry.Request.PostData.MimeType)
+	utils.AssertEqual(t, &HARNameValue{Name: "Action", Value: "Run"}, entry.Request.QueryString[0])
+	for _, header := range entry.Request.Headers {
+		if header.Name == "authorization" {
+			utils.AssertEqual(t, utils.RedactedValue, header.Value)
+		}
+	}
+	utils.AssertEqual(t, 400, entry.Response.Status)
+	utils.AssertEqual(t, "Bad Request", entry.Response.StatusText)
+	utils.AssertEqual(t, `{"Code":"Invalid","SecurityToken":"******"}`, entry.Response.Content.Text)
+	utils.AssertEqual(t, "https://ecs.aliyuncs.com/moved", entry.Response.RedirectURL)
+	utils.AssertEqual(t, true, entry.Time > 0)
+	utils.AssertEqual(t, float64(-1), entry.Timings.DNS)
+	utils.AssertEqual(t, "base64", har.Log.Entries[1].Response.Content.Encoding)
+	utils.AssertEqual(t, "/wA=", har.Log.Entries[1].Response.Content.Text)
+	utils.AssertNil(t, har.Log.Entries[1].Request.PostData)
+
+	dir, err := ioutil.TempDir("", "har")
+	utils.AssertNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calls.har")
+	utils.AssertNil(t, recorder.WriteFile(path))
+	byt, err := ioutil.ReadFile(path)
+	utils.AssertNil(t, err)
+	loaded := new(HAR)
+	utils.AssertNil(t, json.Unmarshal(byt, loaded))
+	utils.AssertEqual(t, 2, len(loaded.Log.Entries))
+	utils.AssertEqual(t, "alibabacloud-go/tea", loaded.Log.Creator.Name)
+}
+
+func Test_HARRecorderStreamsResponse(t *testing.T) {
+	reader, writer := io.Pipe()
+	stub := &stubClient{
+		handler: func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", "text/event-stream")
+			return &http.Response{StatusCode: 200, Status: "200 OK", Header: header, Body: reader}, nil
+		},
+	}
+	recorder := NewHARRecorder(stub)
+	request := NewRequest()
+	request.Headers["host"] = String("ecs.aliyuncs.com")
+	// the response is returned before the stream ends
+	resp, err := DoRequest(request, &RuntimeObject{HttpClient: recorder})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(recorder.HAR().Log.Entries))
+	utils.AssertEqual(t, "", recorder.HAR().Log.Entries[0].Response.Content.Text)
+
+	go writer.Write([]byte("data: 1\n\n"))
+	event := make([]byte, 9)
+	_, err = io.ReadFull(resp.Body, event)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "data: 1\n\n", string(event))
+	go func() {
+		writer.Write([]byte("data: 2\n\n"))
+		writer.Close()
+	}()
+	rest, err := ioutil.ReadAll(resp.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "data: 2\n\n", string(rest))
+	entry := recorder.HAR().Log.Entries[0]
+	utils.AssertEqual(t, "data: 1\n\ndata: 2\n\n", entry.Response.Content.Text)
+	utils.AssertEqual(t, int64(18), entry.Response.BodySize)
+}
+
+func Test_harDuration(t *testing.T) {
+	start := time.Now()
+	utils.AssertEqual(t, float64(-1), harDuration(time.Time{}, start))
+	utils.AssertEqual(t, float64(2), harDuration(start, start.Add(2*time.Millisecond)))
+}
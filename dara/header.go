@@ -0,0 +1,108 @@
+package dara
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// HeaderCasePreserve sends header names as they are in Request.Headers
+	HeaderCasePreserve = "preserve"
+	// HeaderCaseCanonical sends header names in canonical MIME case, e.g. X-Acs-Date
+	HeaderCaseCanonical = "canonical"
+	// HeaderCaseLowercase sends header names in lowercase
+	HeaderCaseLowercase = "lowercase"
+)
+
+// HeaderField is one header line of a request
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// checkHeaderCase returns an error when policy is not a known header case policy
+func checkHeaderCase(policy string) error {
+	switch policy {
+	case "", HeaderCasePreserve, HeaderCaseCanonical, HeaderCaseLowercase:
+		return nil
+	}
+	return fmt.Errorf("dara: unsupported header case %q", policy)
+}
+
+// headerName returns the name key has on the wire under policy. Host,
+// User-Agent and Content-Length are written by net/http itself and always
+// keep their canonical name.
+func headerName(key, policy string) string {
+	canonical := http.CanonicalHeaderKey(key)
+	switch canonical {
+	case "Host", "User-Agent", "Content-Length":
+		return canonical
+	}
+	switch policy {
+	case HeaderCaseCanonical:
+		return canonical
+	case HeaderCaseLowercase:
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// WireHeaders returns the headers of request as DoRequest writes them under
+// the header case policy: Host, User-Agent and Content-Length first, then the
+// other headers sorted by name, each with its values in order. An empty policy
+// preserves the names. Signers must use it so that the headers they cover are
+// the ones sent. Only the first value of Host, User-Agent and Content-Length is
+// kept.
+func WireHeaders(request *Request, policy string) []HeaderField {
+	keys := make([]string, 0, len(request.Headers))
+	for key, value := range request.Headers {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	names := make([]string, 0, len(keys))
+	values := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		name := headerName(key, policy)
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], *request.Headers[key])
+		values[name] = append(values[name], request.extraHeaders[key]...)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if wireRank(names[i]) != wireRank(names[j]) {
+			return wireRank(names[i]) < wireRank(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	fields := make([]HeaderField, 0, len(names))
+	for _, name := range names {
+		if wireRank(name) < 3 {
+			// net/http writes a single value of these
+			values[name] = values[name][:1]
+		}
+		for _, value := range values[name] {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+		}
+	}
+	return fields
+}
+
+// wireRank orders the headers net/http writes before the others
+func wireRank(name string) int {
+	switch name {
+	case "Host":
+		return 0
+	case "User-Agent":
+		return 1
+	case "Content-Length":
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,124 @@
+package dara
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newHeaderRequest() *Request {
+	request := NewRequest()
+	request.Headers["host"] = String("example.com")
+	request.Headers["user-agent"] = String("dara")
+	request.Headers["content-length"] = String("0")
+	request.Headers["x-acs-date"] = String("2024-01-01T00:00:00Z")
+	request.Headers["Content-Type"] = String("application/json")
+	request.AddHeader("X-Acs-Tag", "a")
+	request.AddHeader("X-Acs-Tag", "b")
+	return request
+}
+
+func Test_WireHeaders(t *testing.T) {
+	request := newHeaderRequest()
+	fields := WireHeaders(request, HeaderCaseCanonical)
+	utils.AssertEqual(t, []HeaderField{
+		{Name: "Host", Value: "example.com"},
+		{Name: "User-Agent", Value: "dara"},
+		{Name: "Content-Length", Value: "0"},
+		{Name: "Content-Type", Value: "application/json"},
+		{Name: "X-Acs-Date", Value: "2024-01-01T00:00:00Z"},
+		{Name: "X-Acs-Tag", Value: "a"},
+		{Name: "X-Acs-Tag", Value: "b"},
+	}, fields)
+
+	fields = WireHeaders(request, HeaderCaseLowercase)
+	utils.AssertEqual(t, "Host", fields[0].Name)
+	utils.AssertEqual(t, "content-type", fields[3].Name)
+	utils.AssertEqual(t, "x-acs-date", fields[4].Name)
+	utils.AssertEqual(t, "x-acs-tag", fields[6].Name)
+
+	fields = WireHeaders(request, "")
+	utils.AssertEqual(t, "Content-Type", fields[3].Name)
+	utils.AssertEqual(t, "X-Acs-Tag", fields[4].Name)
+	utils.AssertEqual(t, "x-acs-date", fields[6].Name)
+
+	// names equal after casing are merged
+	request = NewRequest()
+	request.Headers["x-acs-a"] = String("1")
+	request.Headers["X-ACS-A"] = String("2")
+	utils.AssertEqual(t, []HeaderField{{Name: "X-Acs-A", Value: "2"}, {Name: "X-Acs-A", Value: "1"}},
+		WireHeaders(request, HeaderCaseCanonical))
+	utils.AssertEqual(t, 2, len(WireHeaders(request, HeaderCasePreserve)))
+}
+
+// readRawHeaders sends request through DoRequest to a raw listener and returns the header lines it received
+func readRawHeaders(t *testing.T, request *Request, runtime *RuntimeObject) []string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	utils.AssertNil(t, err)
+	defer listener.Close()
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			lines <- nil
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var received []string
+		for {
+			line, err := reader.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			if err != nil || line == "" {
+				break
+			}
+			received = append(received, line)
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+		lines <- received
+	}()
+
+	request.Domain = String(listener.Addr().String())
+	request.Headers["host"] = String(listener.Addr().String())
+	response, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return <-lines
+}
+
+func Test_DoRequestHeaderCase(t *testing.T) {
+	request := newHeaderRequest()
+	delete(request.Headers, "content-length")
+	lines := readRawHeaders(t, request, &RuntimeObject{HeaderCase: String(HeaderCaseLowercase)})
+	utils.AssertContains(t, strings.Join(lines, "\n"), "User-Agent: dara", "content-type: application/json",
+		"x-acs-date: 2024-01-01T00:00:00Z", "x-acs-tag: a\nx-acs-tag: b")
+	utils.AssertEqual(t, false, strings.Contains(strings.Join(lines, "\n"), "Go-http-client"))
+
+	request = newHeaderRequest()
+	delete(request.Headers, "content-length")
+	lines = readRawHeaders(t, request, &RuntimeObject{HeaderCase: String(HeaderCaseCanonical)})
+	utils.AssertContains(t, strings.Join(lines, "\n"), "Content-Type: application/json",
+		"X-Acs-Date: 2024-01-01T00:00:00Z", "X-Acs-Tag: a\nX-Acs-Tag: b")
+
+	request = newHeaderRequest()
+	delete(request.Headers, "content-length")
+	lines = readRawHeaders(t, request, nil)
+	utils.AssertContains(t, strings.Join(lines, "\n"), "Content-Type: application/json",
+		"x-acs-date: 2024-01-01T00:00:00Z", "X-Acs-Tag: a")
+
+	_, err := DoRequest(NewRequest(), &RuntimeObject{HeaderCase: String("upper")})
+	utils.AssertEqual(t, `dara: unsupported header case "upper"`, err.Error())
+
+	runtime := NewRuntimeObject(map[string]interface{}{"headerCase": HeaderCaseCanonical})
+	utils.AssertEqual(t, HeaderCaseCanonical, StringValue(runtime.HeaderCase))
+	header := http.Header{}
+	setRequestHeaders(header, newHeaderRequest(), HeaderCaseLowercase)
+	utils.AssertNil(t, header["Content-Length"])
+	utils.AssertEqual(t, []string{"dara"}, header["User-Agent"])
+}
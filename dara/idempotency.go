@@ -0,0 +1,69 @@
+package dara
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// IdempotencyInQuery puts the client token into the query string
+	IdempotencyInQuery = "query"
+	// IdempotencyInHeader puts the client token into a header
+	IdempotencyInHeader = "header"
+)
+
+// IdempotencyOptions makes DoRequest send a client token with every request.
+// The token is the one given to Request.SetIdempotencyToken, else a new UUID
+// per request. A retry loop shares one token between its attempts by giving
+// each request the IdempotencyToken of its RetryPolicyContext, which
+// ShouldRetry generates for the first attempt and carries over from
+// HttpRequest to the next ones, as Request.SetRetryPolicyContext does. A
+// token already set on the request is kept.
+type IdempotencyOptions struct {
+	// Name of the query parameter or header, e.g. ClientToken
+	Name string
+	// In is IdempotencyInQuery, the default, or IdempotencyInHeader
+	In string
+}
+
+// SetIdempotencyToken makes DoRequest send token as the client token of request
+func (request *Request) SetIdempotencyToken(token string) {
+	request.idempotencyToken = token
+}
+
+// injectIdempotencyToken puts the client token of request into it unless it
+// already has one, generating a token when none was set
+func injectIdempotencyToken(request *Request, runtimeObject *RuntimeObject) error {
+	options := runtimeObject.Idempotency
+	if options == nil {
+		return nil
+	}
+	token := request.idempotencyToken
+	if token == "" {
+		token = newUUID()
+	}
+	if options.Name == "" {
+		return fmt.Errorf("dara: the idempotency token has no name")
+	}
+	switch strings.ToLower(options.In) {
+	case "", IdempotencyInQuery:
+		if request.Query == nil {
+			request.Query = make(map[string]*string)
+		}
+		if StringValue(request.Query[options.Name]) == "" {
+			request.Query[options.Name] = String(token)
+		}
+		request.idempotencyToken = StringValue(request.Query[options.Name])
+	case IdempotencyInHeader:
+		if request.Headers == nil {
+			request.Headers = make(map[string]*string)
+		}
+		if getHeaderValue(request.Headers, options.Name) == "" {
+			setHeaderValue(request.Headers, options.Name, token)
+		}
+		request.idempotencyToken = getHeaderValue(request.Headers, options.Name)
+	default:
+		return fmt.Errorf("dara: unsupported idempotency token location %q", options.In)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// callWithRetries runs a call the way generated clients do, building a new
+// request with the token of the retry context for every attempt, and returns
+// the contexts given to ShouldRetry
+func callWithRetries(t *testing.T, runtime *RuntimeObject, build func() *Request) []*RetryPolicyContext {
+	var contexts []*RetryPolicyContext
+	retryPolicyContext := &RetryPolicyContext{RetriesAttempted: 0}
+	for ShouldRetry(runtime.RetryOptions, retryPolicyContext) {
+		contexts = append(contexts, retryPolicyContext)
+		request := build()
+		request.SetRetryPolicyContext(retryPolicyContext)
+		response, err := DoRequest(request, runtime)
+		utils.AssertNil(t, err)
+		if IntValue(response.StatusCode) == 200 {
+			break
+		}
+		retryPolicyContext = &RetryPolicyContext{
+			RetriesAttempted: retryPolicyContext.RetriesAttempted + 1,
+			HttpRequest:      request,
+			HttpResponse:     response,
+			Exception:        (&AErr{}).New(map[string]interface{}{"code": "Throttling"}),
+		}
+	}
+	return contexts
+}
+
+func Test_IdempotencyToken(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var tokens []string
+	var stringToSign string
+	failures := 0
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			tokens = append(tokens, req.URL.Query().Get("ClientToken")+strings.Join(req.Header["x-acs-client-token"], ""))
+			status := 200
+			if failures > 0 {
+				failures--
+				status = 503
+			}
+			return &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+	retryOptions := &RetryOptions{
+		Retryable:      true,
+		RetryCondition: []*RetryCondition{{MaxAttempts: 3, Exception: []string{"AErr"}}},
+	}
+	build := func() *Request {
+		request := NewRequest()
+		request.Method = String("POST")
+		request.Query["Action"] = String("CreateInstance")
+		return request
+	}
+
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"idempotency": &IdempotencyOptions{Name: "ClientToken"},
+		"signer": &RPCSigner{
+			Credential: &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"},
+			Debug:      func(info *SignatureInfo) { stringToSign = info.StringToSign },
+		},
+	})
+	runtime.RetryOptions = retryOptions
+	failures = 2
+	contexts := callWithRetries(t, runtime, build)
+	utils.AssertEqual(t, 3, len(tokens))
+	utils.AssertEqual(t, true, uuidPattern.MatchString(tokens[0]))
+	utils.AssertEqual(t, tokens[0], tokens[1])
+	utils.AssertEqual(t, tokens[0], tokens[2])
+	utils.AssertEqual(t, tokens[0], contexts[0].IdempotencyToken)
+	utils.AssertEqual(t, tokens[0], contexts[1].IdempotencyToken)
+	utils.AssertEqual(t, tokens[0], contexts[2].IdempotencyToken)
+	// the token is signed
+	utils.AssertContains(t, stringToSign, "%26ClientToken%3D"+tokens[0]+"%26")
+
+	// the next call with the same runtime gets another token
+	first := tokens[0]
+	tokens = nil
+	failures = 1
+	contexts = callWithRetries(t, runtime, build)
+	utils.AssertEqual(t, 2, len(tokens))
+	utils.AssertEqual(t, true, uuidPattern.MatchString(tokens[0]))
+	utils.AssertEqual(t, false, first == tokens[0])
+	utils.AssertEqual(t, tokens[0], tokens[1])
+	utils.AssertEqual(t, tokens[0], contexts[1].IdempotencyToken)
+
+	// requests sent on their own get a token each
+	tokens = nil
+	other := &RuntimeObject{Idempotency: &IdempotencyOptions{Name: "x-acs-client-token", In: IdempotencyInHeader}}
+	_, err := DoRequest(build(), other)
+	utils.AssertNil(t, err)
+	_, err = DoRequest(build(), other)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, uuidPattern.MatchString(tokens[0]))
+	utils.AssertEqual(t, true, uuidPattern.MatchString(tokens[1]))
+	utils.AssertEqual(t, false, tokens[0] == tokens[1])
+
+	// a token set by the caller is kept
+	tokens = nil
+	failures = 1
+	contexts = callWithRetries(t, runtime, func() *Request {
+		request := build()
+		request.Query["ClientToken"] = String("caller-token")
+		return request
+	})
+	utils.AssertEqual(t, []string{"caller-token", "caller-token"}, tokens)
+	utils.AssertEqual(t, "caller-token", contexts[1].IdempotencyToken)
+
+	_, err = DoRequest(build(), &RuntimeObject{Idempotency: &IdempotencyOptions{}})
+	utils.AssertEqual(t, "dara: the idempotency token has no name", err.Error())
+	_, err = DoRequest(build(), &RuntimeObject{Idempotency: &IdempotencyOptions{Name: "ClientToken", In: "body"}})
+	utils.AssertEqual(t, `dara: unsupported idempotency token location "body"`, err.Error())
+}
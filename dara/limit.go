@@ -0,0 +1,70 @@
+package dara
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ResponseTooLargeError is returned when a body read into memory is larger than the limit
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (err *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("dara: response body is larger than %d bytes", err.Limit)
+}
+
+// GetName returns the name used by retry conditions
+func (err *ResponseTooLargeError) GetName() *string {
+	return String("ResponseTooLargeError")
+}
+
+// GetCode returns the code used by retry conditions
+func (err *ResponseTooLargeError) GetCode() *string {
+	return String("ResponseTooLarge")
+}
+
+// limitedBody carries the RuntimeObject.MaxResponseBodySize of a response.
+// Streaming reads through it are not limited, only the helpers which read the
+// whole body into memory enforce it.
+type limitedBody struct {
+	io.ReadCloser
+	limit         int64
+	contentLength int64
+}
+
+// setBody replaces the body of response, keeping the size limit DoRequest
+// attached to it for the helpers which are only given the body
+func (response *Response) setBody(body io.ReadCloser) {
+	if response.bodyLimit > 0 {
+		body = &limitedBody{ReadCloser: body, limit: response.bodyLimit, contentLength: response.bodyContentLength}
+	}
+	response.Body = body
+}
+
+// bodySizeLimit returns the limit DoRequest attached to body, 0 when there is none
+func bodySizeLimit(body io.Reader) int64 {
+	if limited, ok := body.(*limitedBody); ok {
+		return limited.limit
+	}
+	return 0
+}
+
+// readAllWithLimit reads body until EOF, a limit not greater than 0 reads it all
+func readAllWithLimit(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(body)
+	}
+	if limited, ok := body.(*limitedBody); ok && limited.contentLength > limit {
+		return nil, &ResponseTooLargeError{Limit: limit}
+	}
+	byt, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(byt)) > limit {
+		return nil, &ResponseTooLargeError{Limit: limit}
+	}
+	return byt, nil
+}
@@ -0,0 +1,179 @@
+package dara
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_readAllWithLimit(t *testing.T) {
+	byt, err := readAllWithLimit(strings.NewReader("0123456789"), 0)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "0123456789", string(byt))
+
+	byt, err = readAllWithLimit(strings.NewReader("0123456789"), 10)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "0123456789", string(byt))
+
+	_, err = readAllWithLimit(strings.NewReader("0123456789"), 9)
+	utils.AssertEqual(t, "dara: response body is larger than 9 bytes", err.Error())
+	tooLarge, ok := err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, int64(9), tooLarge.Limit)
+	utils.AssertEqual(t, "ResponseTooLargeError", StringValue(tooLarge.GetName()))
+	utils.AssertEqual(t, "ResponseTooLarge", StringValue(tooLarge.GetCode()))
+
+	// the content length fails fast
+	body := &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("")), limit: 5, contentLength: 6}
+	_, err = readAllWithLimit(body, 5)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+}
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (body *closeCounter) Close() error {
+	body.closed++
+	return nil
+}
+
+func Test_ReadAsWithLimitCloses(t *testing.T) {
+	readers := []func(io.Reader, int64) error{
+		func(body io.Reader, limit int64) error {
+			_, err := ReadAsBytesWithLimit(body, limit)
+			return err
+		},
+		func(body io.Reader, limit int64) error {
+			_, err := ReadAsJSONWithLimit(body, limit)
+			return err
+		},
+		func(body io.Reader, limit int64) error {
+			_, err := ReadAsStringWithLimit(body, limit)
+			return err
+		},
+	}
+	for _, read := range readers {
+		// an oversized body is closed as well
+		body := &closeCounter{Reader: strings.NewReader(`{"a":"0123456789"}`)}
+		_, ok := read(body, 5).(*ResponseTooLargeError)
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, 1, body.closed)
+
+		body = &closeCounter{Reader: strings.NewReader(`{"a":"0123456789"}`)}
+		utils.AssertNil(t, read(body, 0))
+		utils.AssertEqual(t, 1, body.closed)
+	}
+}
+
+func Test_DoRequestWithMaxResponseBodySize(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Header: http.Header{}, ContentLength: -1,
+				Body: ioutil.NopCloser(strings.NewReader(`{"key":"value"}`))}, nil
+		}
+	}
+	runtime := &RuntimeObject{MaxResponseBodySize: Int(10)}
+
+	response, err := DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	_, err = response.ReadBody()
+	_, ok := err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	_, err = ReadAsBytes(response.Body)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	_, err = ReadAsJSON(response.Body)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	_, err = ReadAsString(response.Body)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	// the limit of a helper overrides the runtime one
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	str, err := ReadAsStringWithLimit(response.Body, 100)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"key":"value"}`, str)
+
+	response, err = DoRequest(NewRequest(), nil)
+	utils.AssertNil(t, err)
+	_, err = ReadAsJSONWithLimit(response.Body, 5)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	response, err = DoRequest(NewRequest(), nil)
+	utils.AssertNil(t, err)
+	_, err = ReadAsBytesWithLimit(response.Body, 5)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	response, err = DoRequest(NewRequest(), nil)
+	utils.AssertNil(t, err)
+	byt, err := response.ReadBodyWithLimit(15)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"key":"value"}`, string(byt))
+
+	// the limit is kept when the body is wrapped
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("x-oss-hash-crc64ecma", "0")
+			header.Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			return &http.Response{StatusCode: 400, Header: header, ContentLength: -1,
+				Body: ioutil.NopCloser(strings.NewReader(`{"Code":"InvalidParameter"}`))}, nil
+		}
+	}
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	utils.AssertNil(t, VerifyResponseChecksum(response, ChecksumCRC64, "x-oss-hash-crc64ecma"))
+	_, err = response.ReadBody()
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	// the error code of a response is peeked when the clock offset changes
+	request := NewRequest()
+	request.Headers["host"] = String("limit.example.com")
+	defer SetClockOffset("limit.example.com", 0)
+	response, err = DoRequest(request, &RuntimeObject{
+		MaxResponseBodySize: Int(10),
+		Signer:              &RPCSigner{Credential: &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}},
+	})
+	utils.AssertNil(t, err)
+	_, err = ReadAsBytes(response.Body)
+	_, ok = err.(*ResponseTooLargeError)
+	utils.AssertEqual(t, true, ok)
+
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Header: http.Header{}, ContentLength: -1,
+				Body: ioutil.NopCloser(strings.NewReader(`{"key":"value"}`))}, nil
+		}
+	}
+
+	// streaming reads are not limited
+	response, err = DoRequest(NewRequest(), runtime)
+	utils.AssertNil(t, err)
+	byt, err = ioutil.ReadAll(response.Body)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, `{"key":"value"}`, string(byt))
+}
@@ -0,0 +1,351 @@
+package dara
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+const (
+	// DefaultUploadPartSize is the size of each part of a multipart upload
+	DefaultUploadPartSize int64 = 8 * 1024 * 1024
+	// DefaultPartAttempts is the number of times a part is sent before giving up
+	DefaultPartAttempts = 3
+)
+
+// UploadPart is a part of a multipart upload
+type UploadPart struct {
+	// Number starts at 1
+	Number int    `json:"number"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+	// CRC64 is the CRC-64/ECMA of the part as sent, in decimal. A resumed
+	// upload sends again the parts of a checkpoint when the source differs.
+	CRC64 string `json:"crc64,omitempty"`
+}
+
+// MultipartCallbacks are the service calls of a multipart upload
+type MultipartCallbacks struct {
+	// Init starts an upload and returns its id
+	Init func(ctx context.Context) (uploadID string, err error)
+	// UploadPart sends body as part and returns the ETag of the part
+	UploadPart func(ctx context.Context, uploadID string, part *UploadPart, body io.ReadSeeker) (etag string, err error)
+	// Complete assembles the parts, sorted by number
+	Complete func(ctx context.Context, uploadID string, parts []*UploadPart) error
+	// Abort discards an upload and the parts sent
+	Abort func(ctx context.Context, uploadID string) error
+}
+
+// MultipartUploadOptions controls how UploadMultipart splits and sends the source
+type MultipartUploadOptions struct {
+	// PartSize is the number of bytes of each part
+	PartSize int64
+	// Parallel is the number of parts sent at the same time
+	Parallel int
+	// PartAttempts is the number of times a part is sent before the upload fails
+	PartAttempts int
+	// Backoff returns the delay before sending a failed part again
+	Backoff BackoffPolicy
+	// CheckpointPath records the upload id and the sent parts so a failed upload can be resumed
+	CheckpointPath string
+	// Listener is notified each time a part is sent
+	Listener utils.ProgressListener
+}
+
+// uploadCheckpoint is the file format of a multipart upload checkpoint
+type uploadCheckpoint struct {
+	UploadID string        `json:"uploadId"`
+	Size     int64         `json:"size"`
+	PartSize int64         `json:"partSize"`
+	Parts    []*UploadPart `json:"parts"`
+}
+
+type multipartUploader struct {
+	sync.Mutex
+	source     io.ReaderAt
+	callbacks  *MultipartCallbacks
+	options    *MultipartUploadOptions
+	checkpoint *uploadCheckpoint
+	consumed   int64
+	err        error
+}
+
+// UploadFileMultipart uploads file with UploadMultipart
+func UploadFileMultipart(ctx context.Context, file *DaraFile, callbacks *MultipartCallbacks, options *MultipartUploadOptions) error {
+	size, err := file.Length()
+	if err != nil {
+		return err
+	}
+	return UploadMultipart(ctx, file, size, callbacks, options)
+}
+
+// UploadMultipart splits the size bytes of source into parts and sends them
+// through callbacks. A part failing PartAttempts times stops the upload: when
+// CheckpointPath is set the upload is kept and calling UploadMultipart again
+// only sends the missing parts, otherwise it is aborted. A checkpoint whose
+// sent parts no longer match source is discarded and its upload aborted.
+// Cancelling ctx always aborts the upload and removes the checkpoint.
+func UploadMultipart(ctx context.Context, source io.ReaderAt, size int64, callbacks *MultipartCallbacks, options *MultipartUploadOptions) (err error) {
+	if options == nil {
+		options = &MultipartUploadOptions{}
+	}
+	uploader := &multipartUploader{
+		source:    source,
+		callbacks: callbacks,
+		options:   options,
+	}
+	uploader.checkpoint = uploader.loadCheckpoint(ctx, size)
+	if uploader.checkpoint.UploadID == "" {
+		uploadID, err := callbacks.Init(ctx)
+		if err != nil {
+			return err
+		}
+		uploader.checkpoint.UploadID = uploadID
+		if err = uploader.saveCheckpoint(); err != nil {
+			return uploader.abort(ctx, err)
+		}
+	}
+
+	pending := make(chan *UploadPart, len(uploader.checkpoint.Parts))
+	for _, part := range uploader.checkpoint.Parts {
+		if part.ETag == "" {
+			pending <- part
+		} else {
+			uploader.consumed += part.Size
+		}
+	}
+	close(pending)
+	utils.PublishProgress(options.Listener, utils.NewProgressEvent(utils.TransferStartedEvent, uploader.consumed, size, 0))
+	defer func() {
+		eventType := utils.TransferCompletedEvent
+		if err != nil {
+			eventType = utils.TransferFailedEvent
+		}
+		utils.PublishProgress(options.Listener, utils.NewProgressEvent(eventType, uploader.consumed, size, 0))
+	}()
+
+	parallel := options.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range pending {
+				if uploader.failed() || ctx.Err() != nil {
+					return
+				}
+				if err := uploader.uploadPart(ctx, part); err != nil {
+					uploader.fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return uploader.abort(ctx, ctx.Err())
+	}
+	if uploader.err != nil {
+		return uploader.stop(ctx, uploader.err)
+	}
+
+	parts := make([]*UploadPart, len(uploader.checkpoint.Parts))
+	copy(parts, uploader.checkpoint.Parts)
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	if err = callbacks.Complete(ctx, uploader.checkpoint.UploadID, parts); err != nil {
+		if ctx.Err() != nil {
+			return uploader.abort(ctx, err)
+		}
+		return uploader.stop(ctx, err)
+	}
+	uploader.removeCheckpoint()
+	return nil
+}
+
+// uploadPart sends part until it succeeds or PartAttempts is reached
+func (uploader *multipartUploader) uploadPart(ctx context.Context, part *UploadPart) error {
+	attempts := uploader.options.PartAttempts
+	if attempts <= 0 {
+		attempts = DefaultPartAttempts
+	}
+	checksum, err := uploader.partChecksum(part)
+	if err != nil {
+		return err
+	}
+	retryContext := &RetryPolicyContext{Key: fmt.Sprintf("part-%d", part.Number)}
+	for {
+		body := io.NewSectionReader(uploader.source, part.Offset, part.Size)
+		etag, err := uploader.callbacks.UploadPart(ctx, uploader.checkpoint.UploadID, part, body)
+		if err == nil {
+			return uploader.finishPart(part, etag, checksum)
+		}
+		retryContext.RetriesAttempted++
+		retryContext.Exception = err
+		if retryContext.RetriesAttempted >= attempts || ctx.Err() != nil {
+			return err
+		}
+		delay := MIN_DELAY_TIME
+		if uploader.options.Backoff != nil {
+			delay = uploader.options.Backoff.GetDelayTime(retryContext)
+		}
+		timer := time.NewTimer(time.Duration(delay) * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// partChecksum returns the CRC-64 of part read from the source
+func (uploader *multipartUploader) partChecksum(part *UploadPart) (string, error) {
+	h := crc64.New(crc64Table)
+	if _, err := io.Copy(h, io.NewSectionReader(uploader.source, part.Offset, part.Size)); err != nil {
+		return "", err
+	}
+	return formatChecksum(ChecksumCRC64, h.Sum(nil)), nil
+}
+
+func (uploader *multipartUploader) finishPart(part *UploadPart, etag, checksum string) error {
+	uploader.Lock()
+	defer uploader.Unlock()
+	part.ETag = etag
+	part.CRC64 = checksum
+	uploader.consumed += part.Size
+	event := utils.NewProgressEvent(utils.TransferDataEvent, uploader.consumed, uploader.checkpoint.Size, part.Size)
+	utils.PublishProgress(uploader.options.Listener, event)
+	return uploader.saveCheckpointLocked()
+}
+
+func (uploader *multipartUploader) fail(err error) {
+	uploader.Lock()
+	defer uploader.Unlock()
+	if uploader.err == nil {
+		uploader.err = err
+	}
+}
+
+func (uploader *multipartUploader) failed() bool {
+	uploader.Lock()
+	defer uploader.Unlock()
+	return uploader.err != nil
+}
+
+// stop keeps a checkpointed upload for resuming and aborts the others
+func (uploader *multipartUploader) stop(ctx context.Context, err error) error {
+	if uploader.options.CheckpointPath != "" {
+		return err
+	}
+	return uploader.abort(ctx, err)
+}
+
+// abort discards the upload, err is returned as the cause
+func (uploader *multipartUploader) abort(ctx context.Context, err error) error {
+	uploader.removeCheckpoint()
+	if uploader.callbacks.Abort == nil {
+		return err
+	}
+	// the upload is aborted even though ctx is done
+	if abortErr := uploader.callbacks.Abort(context.Background(), uploader.checkpoint.UploadID); abortErr != nil {
+		return fmt.Errorf("%v, abort upload %s: %v", err, uploader.checkpoint.UploadID, abortErr)
+	}
+	return err
+}
+
+// loadCheckpoint returns the saved checkpoint when it matches size, the part
+// size and the source, a new one without upload id otherwise. The upload of a
+// checkpoint whose parts differ from the source is aborted.
+func (uploader *multipartUploader) loadCheckpoint(ctx context.Context, size int64) *uploadCheckpoint {
+	partSize := uploader.options.PartSize
+	if partSize <= 0 {
+		partSize = DefaultUploadPartSize
+	}
+	if uploader.options.CheckpointPath != "" {
+		checkpoint := new(uploadCheckpoint)
+		byt, err := ioutil.ReadFile(uploader.options.CheckpointPath)
+		if err == nil && json.Unmarshal(byt, checkpoint) == nil && checkpoint.UploadID != "" &&
+			checkpoint.Size == size && checkpoint.PartSize == partSize {
+			if uploader.partsMatch(checkpoint) {
+				return checkpoint
+			}
+			debugLog("> the source of upload %s changed, starting over", checkpoint.UploadID)
+			if uploader.callbacks.Abort != nil {
+				uploader.callbacks.Abort(ctx, checkpoint.UploadID)
+			}
+		}
+	}
+	checkpoint := &uploadCheckpoint{
+		Size:     size,
+		PartSize: partSize,
+		Parts:    make([]*UploadPart, 0),
+	}
+	for offset := int64(0); offset < size || len(checkpoint.Parts) == 0; offset += partSize {
+		part := &UploadPart{
+			Number: len(checkpoint.Parts) + 1,
+			Offset: offset,
+			Size:   partSize,
+		}
+		if offset+partSize > size {
+			part.Size = size - offset
+		}
+		checkpoint.Parts = append(checkpoint.Parts, part)
+	}
+	return checkpoint
+}
+
+// partsMatch reports whether the parts sent in checkpoint are still the ones of the source
+func (uploader *multipartUploader) partsMatch(checkpoint *uploadCheckpoint) bool {
+	for _, part := range checkpoint.Parts {
+		if part.ETag == "" {
+			continue
+		}
+		checksum, err := uploader.partChecksum(part)
+		if err != nil || part.CRC64 == "" || checksum != part.CRC64 {
+			return false
+		}
+	}
+	return true
+}
+
+func (uploader *multipartUploader) saveCheckpoint() error {
+	uploader.Lock()
+	defer uploader.Unlock()
+	return uploader.saveCheckpointLocked()
+}
+
+func (uploader *multipartUploader) saveCheckpointLocked() error {
+	if uploader.options.CheckpointPath == "" {
+		return nil
+	}
+	byt, err := json.Marshal(uploader.checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := uploader.options.CheckpointPath + ".tmp"
+	if err = ioutil.WriteFile(tmp, byt, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, uploader.options.CheckpointPath)
+}
+
+func (uploader *multipartUploader) removeCheckpoint() {
+	if uploader.options.CheckpointPath != "" {
+		os.Remove(uploader.options.CheckpointPath)
+	}
+}
@@ -0,0 +1,232 @@
+package dara
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// fakeMultipartService keeps the parts sent through its callbacks
+type fakeMultipartService struct {
+	sync.Mutex
+	inits     int
+	attempts  map[int]int
+	failures  map[int]int
+	parts     map[int][]byte
+	completed []byte
+	aborted   []string
+	onPart    func(part *UploadPart)
+}
+
+func newFakeMultipartService() *fakeMultipartService {
+	return &fakeMultipartService{
+		attempts: make(map[int]int),
+		failures: make(map[int]int),
+		parts:    make(map[int][]byte),
+	}
+}
+
+func (service *fakeMultipartService) callbacks() *MultipartCallbacks {
+	return &MultipartCallbacks{
+		Init: func(ctx context.Context) (string, error) {
+			service.Lock()
+			defer service.Unlock()
+			service.inits++
+			return fmt.Sprintf("upload-%d", service.inits), nil
+		},
+		UploadPart: func(ctx context.Context, uploadID string, part *UploadPart, body io.ReadSeeker) (string, error) {
+			if service.onPart != nil {
+				service.onPart(part)
+			}
+			byt, err := ioutil.ReadAll(body)
+			if err != nil {
+				return "", err
+			}
+			service.Lock()
+			defer service.Unlock()
+			service.attempts[part.Number]++
+			if service.failures[part.Number] > 0 {
+				service.failures[part.Number]--
+				return "", errors.New("part failed")
+			}
+			service.parts[part.Number] = byt
+			return fmt.Sprintf("etag-%d", part.Number), nil
+		},
+		Complete: func(ctx context.Context, uploadID string, parts []*UploadPart) error {
+			service.Lock()
+			defer service.Unlock()
+			for i, part := range parts {
+				if part.Number != i+1 || part.ETag != fmt.Sprintf("etag-%d", part.Number) {
+					return fmt.Errorf("unexpected part %d", part.Number)
+				}
+				service.completed = append(service.completed, service.parts[part.Number]...)
+			}
+			return nil
+		},
+		Abort: func(ctx context.Context, uploadID string) error {
+			service.Lock()
+			defer service.Unlock()
+			service.aborted = append(service.aborted, uploadID)
+			return nil
+		},
+	}
+}
+
+func Test_UploadMultipart(t *testing.T) {
+	payload := newPayload(1050)
+	service := newFakeMultipartService()
+	service.failures[3] = 2
+	listener := &recordListener{}
+	err := UploadMultipart(context.Background(), bytes.NewReader(payload), int64(len(payload)), service.callbacks(), &MultipartUploadOptions{
+		PartSize: 100,
+		Parallel: 4,
+		Backoff:  &FixedBackoffPolicy{Period: 1},
+		Listener: listener,
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, string(payload), string(service.completed))
+	utils.AssertEqual(t, 11, len(service.parts))
+	utils.AssertEqual(t, 3, service.attempts[3])
+	utils.AssertEqual(t, 1, service.attempts[11])
+	utils.AssertEqual(t, 0, len(service.aborted))
+
+	consumed := int64(0)
+	for _, event := range listener.dataEvents() {
+		consumed += event.RwBytes
+	}
+	utils.AssertEqual(t, int64(1050), consumed)
+	utils.AssertEqual(t, utils.TransferCompletedEvent, listener.events[len(listener.events)-1].EventType)
+
+	// a part failing every attempt aborts an upload without checkpoint
+	service = newFakeMultipartService()
+	service.failures[2] = 5
+	err = UploadMultipart(context.Background(), bytes.NewReader(payload), int64(len(payload)), service.callbacks(), &MultipartUploadOptions{
+		PartSize:     500,
+		PartAttempts: 2,
+		Backoff:      &FixedBackoffPolicy{Period: 1},
+	})
+	utils.AssertEqual(t, "part failed", err.Error())
+	utils.AssertEqual(t, 2, service.attempts[2])
+	utils.AssertEqual(t, "upload-1", service.aborted[0])
+	utils.AssertEqual(t, 0, len(service.completed))
+}
+
+func Test_UploadFileMultipartResume(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "multipart")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := newPayload(350)
+	path := filepath.Join(tempDir, "object")
+	utils.AssertNil(t, ioutil.WriteFile(path, payload, 0644))
+	file := NewDaraFile(path)
+	defer file.Close()
+	options := &MultipartUploadOptions{
+		PartSize:       100,
+		PartAttempts:   1,
+		CheckpointPath: filepath.Join(tempDir, "object.checkpoint"),
+	}
+	service := newFakeMultipartService()
+	service.failures[3] = 1
+	err = UploadFileMultipart(context.Background(), file, service.callbacks(), options)
+	utils.AssertEqual(t, "part failed", err.Error())
+	utils.AssertEqual(t, 0, len(service.aborted))
+	exists, _ := Exists(options.CheckpointPath)
+	utils.AssertEqual(t, true, exists)
+
+	err = UploadFileMultipart(context.Background(), file, service.callbacks(), options)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, service.inits)
+	utils.AssertEqual(t, 1, service.attempts[1])
+	utils.AssertEqual(t, 2, service.attempts[3])
+	utils.AssertEqual(t, 1, service.attempts[4])
+	utils.AssertEqual(t, string(payload), string(service.completed))
+	exists, _ = Exists(options.CheckpointPath)
+	utils.AssertEqual(t, false, exists)
+}
+
+func Test_UploadFileMultipartResumeChangedSource(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "multipart")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	payload := newPayload(350)
+	path := filepath.Join(tempDir, "object")
+	utils.AssertNil(t, ioutil.WriteFile(path, payload, 0644))
+	options := &MultipartUploadOptions{
+		PartSize:       100,
+		PartAttempts:   1,
+		CheckpointPath: filepath.Join(tempDir, "object.checkpoint"),
+	}
+	service := newFakeMultipartService()
+	service.failures[3] = 1
+	file := NewDaraFile(path)
+	err = UploadFileMultipart(context.Background(), file, service.callbacks(), options)
+	file.Close()
+	utils.AssertEqual(t, "part failed", err.Error())
+	byt, err := ioutil.ReadFile(options.CheckpointPath)
+	utils.AssertNil(t, err)
+	utils.AssertContains(t, string(byt), `"crc64":"`)
+
+	// the file is rewritten in place with the same size
+	changed := make([]byte, len(payload))
+	for i := range payload {
+		changed[i] = payload[i] ^ 0xff
+	}
+	utils.AssertNil(t, ioutil.WriteFile(path, changed, 0644))
+	file = NewDaraFile(path)
+	defer file.Close()
+	err = UploadFileMultipart(context.Background(), file, service.callbacks(), options)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 2, service.inits)
+	utils.AssertEqual(t, []string{"upload-1"}, service.aborted)
+	utils.AssertEqual(t, 2, service.attempts[1])
+	utils.AssertEqual(t, string(changed), string(service.completed))
+}
+
+func Test_UploadMultipartCancel(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "multipart")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	service := newFakeMultipartService()
+	service.onPart = func(part *UploadPart) {
+		if part.Number == 2 {
+			cancel()
+		}
+	}
+	options := &MultipartUploadOptions{
+		PartSize:       10,
+		CheckpointPath: filepath.Join(tempDir, "checkpoint"),
+	}
+	err = UploadMultipart(ctx, bytes.NewReader(newPayload(100)), 100, service.callbacks(), options)
+	utils.AssertEqual(t, context.Canceled, err)
+	utils.AssertEqual(t, "upload-1", service.aborted[0])
+	utils.AssertEqual(t, 2, len(service.parts))
+	exists, _ := Exists(options.CheckpointPath)
+	utils.AssertEqual(t, false, exists)
+}
+
+func Test_UploadMultipartEmpty(t *testing.T) {
+	service := newFakeMultipartService()
+	err := UploadMultipart(context.Background(), bytes.NewReader(nil), 0, service.callbacks(), nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 1, len(service.parts))
+	utils.AssertEqual(t, 0, len(service.completed))
+}
@@ -0,0 +1,182 @@
+package dara
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPresignExpired is returned by VerifyPresignedURL for an expired url
+	ErrPresignExpired = errors.New("dara: the presigned url has expired")
+	// ErrSignatureMismatch is returned by VerifyPresignedURL when the signature is not the expected one
+	ErrSignatureMismatch = errors.New("dara: the signature of the presigned url does not match")
+)
+
+// Presigner is a Signer which can put the signature of a request into its
+// query string, valid for expires
+type Presigner interface {
+	Presign(request *Request, context *SigningContext, expires time.Duration) error
+}
+
+// Presign signs request into its query string with signer and returns the url,
+// built like DoRequest does with the RFC 3986 query encoding from its
+// Protocol, host header, Port, Pathname and Query. The query of request is
+// changed. The signing time is corrected with the clock offset of the host.
+// signer must implement Presigner.
+func Presign(request *Request, signer Signer, expires time.Duration) (string, error) {
+	presigner, ok := signer.(Presigner)
+	if !ok {
+		return "", fmt.Errorf("dara: %T does not support presigning", signer)
+	}
+	if expires <= 0 {
+		return "", errors.New("dara: the expiration of a presigned url must be positive")
+	}
+	if StringValue(request.Headers["host"]) == "" {
+		return "", errors.New("dara: the request to presign has no host header")
+	}
+	if request.Method == nil {
+		request.Method = String("GET")
+	}
+	context := &SigningContext{Time: ServerTime(StringValue(getRequestDomain(request))), Nonce: newUUID()}
+	if err := presigner.Presign(request, context, expires); err != nil {
+		return "", err
+	}
+	return buildRequestURL(request, QueryEncodingRFC3986), nil
+}
+
+// Presign signs the method, path, query and host of request with the
+// ACS3-HMAC-SHA256 signature into the x-acs-* query parameters
+func (signer *ACS3Signer) Presign(request *Request, context *SigningContext, expires time.Duration) error {
+	credential, err := resolveCredential(context, signer.Credential, signer.Credentials)
+	if err != nil {
+		return err
+	}
+	if request.Query == nil {
+		request.Query = make(map[string]*string)
+	}
+	delete(request.Query, "x-acs-signature")
+	request.Query["x-acs-credential"] = String(credential.AccessKeyId)
+	request.Query["x-acs-date"] = String(context.Time.UTC().Format(iso8601Format))
+	request.Query["x-acs-expires"] = String(strconv.FormatInt(int64(expires/time.Second), 10))
+	request.Query["x-acs-signature-nonce"] = String(context.Nonce)
+	request.Query["x-acs-signed-headers"] = String("host")
+	if credential.SecurityToken != "" {
+		request.Query["x-acs-security-token"] = String(credential.SecurityToken)
+	}
+	host := StringValue(getRequestDomain(request))
+	canonicalRequest, stringToSign, signature := acs3Signature(credential, request, "host:"+host+"\n", "host", "UNSIGNED-PAYLOAD")
+	request.Query["x-acs-signature"] = String(signature)
+	debugSignature(signer.Debug, &SignatureInfo{
+		Algorithm:        SignatureACS3,
+		CanonicalRequest: canonicalRequest,
+		StringToSign:     stringToSign,
+		Signature:        signature,
+	})
+	return nil
+}
+
+// Presign signs the method, the expiration time and the resource of request
+// into the AccessKeyId, Expires and Signature query parameters. The accept,
+// content-md5, content-type and date lines of the string to sign are empty
+// and Expires, in seconds since the epoch, is signed in place of the date.
+func (signer *ROASigner) Presign(request *Request, context *SigningContext, expires time.Duration) error {
+	credential, err := resolveCredential(context, signer.Credential, signer.Credentials)
+	if err != nil {
+		return err
+	}
+	if request.Query == nil {
+		request.Query = make(map[string]*string)
+	}
+	delete(request.Query, "Signature")
+	request.Query["AccessKeyId"] = String(credential.AccessKeyId)
+	request.Query["Expires"] = String(strconv.FormatInt(context.Time.Add(expires).Unix(), 10))
+	if credential.SecurityToken != "" {
+		request.Query["SecurityToken"] = String(credential.SecurityToken)
+	}
+
+	stringToSign := roaPresignStringToSign(request)
+	signature := base64.StdEncoding.EncodeToString(hmacSum(sha1.New, credential.AccessKeySecret, stringToSign))
+	request.Query["Signature"] = String(signature)
+	debugSignature(signer.Debug, &SignatureInfo{Algorithm: SignatureROA, StringToSign: stringToSign, Signature: signature})
+	return nil
+}
+
+// roaPresignStringToSign signs the decoded path, the one a server sees
+func roaPresignStringToSign(request *Request) string {
+	decoded := *request
+	if pathname, err := url.PathUnescape(StringValue(request.Pathname)); err == nil {
+		decoded.Pathname = String(pathname)
+	}
+	return signingMethod(request) + "\n\n\n\n" + StringValue(request.Query["Expires"]) + "\n" + roaResource(&decoded)
+}
+
+// VerifyPresignedURL checks that rawURL, requested with method, was presigned
+// with credential by an ACS3Signer or a ROASigner and has not expired at now
+func VerifyPresignedURL(method, rawURL string, credential *Credential, now time.Time) error {
+	if err := checkCredential(credential); err != nil {
+		return err
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	request := NewRequest()
+	request.Method = String(method)
+	request.Protocol = String(parsed.Scheme)
+	request.Pathname = String(parsed.EscapedPath())
+	request.Headers["host"] = String(parsed.Host)
+	for key, values := range parsed.Query() {
+		for _, value := range values {
+			request.AddQuery(key, value)
+		}
+	}
+
+	var expected, actual string
+	if request.Query["x-acs-signature"] != nil {
+		if StringValue(request.Query["x-acs-credential"]) != credential.AccessKeyId {
+			return ErrSignatureMismatch
+		}
+		signed, err := time.Parse(iso8601Format, StringValue(request.Query["x-acs-date"]))
+		if err != nil {
+			return fmt.Errorf("dara: invalid x-acs-date: %v", err)
+		}
+		seconds, err := strconv.ParseInt(StringValue(request.Query["x-acs-expires"]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("dara: invalid x-acs-expires: %v", err)
+		}
+		if !now.Before(signed.Add(time.Duration(seconds) * time.Second)) {
+			return ErrPresignExpired
+		}
+		actual = StringValue(request.Query["x-acs-signature"])
+		delete(request.Query, "x-acs-signature")
+		_, _, expected = acs3Signature(credential, request, "host:"+parsed.Host+"\n",
+			StringValue(request.Query["x-acs-signed-headers"]), "UNSIGNED-PAYLOAD")
+	} else if request.Query["Signature"] != nil && request.Query["Expires"] != nil {
+		if StringValue(request.Query["AccessKeyId"]) != credential.AccessKeyId {
+			return ErrSignatureMismatch
+		}
+		expires, err := strconv.ParseInt(StringValue(request.Query["Expires"]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("dara: invalid Expires: %v", err)
+		}
+		if now.Unix() >= expires {
+			return ErrPresignExpired
+		}
+		actual = StringValue(request.Query["Signature"])
+		delete(request.Query, "Signature")
+		expected = base64.StdEncoding.EncodeToString(hmacSum(sha1.New, credential.AccessKeySecret, roaPresignStringToSign(request)))
+	} else {
+		return errors.New("dara: the url is not presigned")
+	}
+	if !hmac.Equal([]byte(strings.TrimSpace(actual)), []byte(expected)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package dara
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newPresignRequest() *Request {
+	request := NewRequest()
+	request.Protocol = String("HTTPS")
+	request.Port = Int(8443)
+	request.Pathname = String("/objects/a b*.txt")
+	request.Headers["host"] = String("example.com")
+	request.Query["response-content-type"] = String("text/plain; charset=utf-8")
+	request.AddQuery("tag", "x")
+	request.AddQuery("tag", "y")
+	return request
+}
+
+func Test_PresignACS3(t *testing.T) {
+	credential := &Credential{AccessKeyId: "ak", AccessKeySecret: "sk", SecurityToken: "token"}
+	var info *SignatureInfo
+	signer := &ACS3Signer{Credential: credential, Debug: func(signature *SignatureInfo) { info = signature }}
+	presigned, err := Presign(newPresignRequest(), signer, 10*time.Minute)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, true, strings.HasPrefix(presigned, "https://example.com:8443/objects/a b*.txt?"))
+	utils.AssertContains(t, presigned, "response-content-type=text%2Fplain%3B%20charset%3Dutf-8", "tag=x&tag=y",
+		"x-acs-credential=ak", "x-acs-expires=600", "x-acs-security-token=token", "x-acs-signed-headers=host")
+	utils.AssertContains(t, info.CanonicalRequest, "GET\n/objects/a%20b%2A.txt\n", "\nhost:example.com:8443\n\nhost\nUNSIGNED-PAYLOAD")
+
+	utils.AssertNil(t, VerifyPresignedURL("GET", presigned, credential, time.Now()))
+	utils.AssertEqual(t, ErrPresignExpired, VerifyPresignedURL("GET", presigned, credential, time.Now().Add(11*time.Minute)))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("PUT", presigned, credential, time.Now()))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", strings.Replace(presigned, "tag=y", "tag=z", 1), credential, time.Now()))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", strings.Replace(presigned, ":8443", ":9443", 1), credential, time.Now()))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", presigned, &Credential{AccessKeyId: "ak", AccessKeySecret: "other"}, time.Now()))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", presigned, &Credential{AccessKeyId: "other", AccessKeySecret: "sk"}, time.Now()))
+
+	// an encoded pathname gives the same signature
+	request := newPresignRequest()
+	request.Pathname = String("/objects/a%20b%2A.txt")
+	presigned, err = Presign(request, signer, time.Minute)
+	utils.AssertNil(t, err)
+	utils.AssertContains(t, info.CanonicalRequest, "GET\n/objects/a%20b%2A.txt\n")
+	utils.AssertNil(t, VerifyPresignedURL("GET", presigned, credential, time.Now()))
+}
+
+func Test_PresignROA(t *testing.T) {
+	credential := &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}
+	var info *SignatureInfo
+	signer := &ROASigner{Credentials: NewStaticCredentialsProvider("ak", "sk", ""), Debug: func(signature *SignatureInfo) { info = signature }}
+	request := newPresignRequest()
+	request.Query["empty"] = String("")
+	presigned, err := Presign(request, signer, time.Hour)
+	utils.AssertNil(t, err)
+	expires := StringValue(request.Query["Expires"])
+	utils.AssertEqual(t, "GET\n\n\n\n"+expires+"\n/objects/a b*.txt?AccessKeyId=ak&Expires="+expires+
+		"&empty&response-content-type=text/plain; charset=utf-8&tag=x&tag=y", info.StringToSign)
+	utils.AssertContains(t, presigned, "AccessKeyId=ak", "Expires="+expires, "Signature=")
+
+	utils.AssertNil(t, VerifyPresignedURL("GET", presigned, credential, time.Now()))
+	utils.AssertEqual(t, ErrPresignExpired, VerifyPresignedURL("GET", presigned, credential, time.Now().Add(2*time.Hour)))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", strings.Replace(presigned, "Expires=", "Expires=1", 1), credential, time.Now()))
+	utils.AssertEqual(t, ErrSignatureMismatch, VerifyPresignedURL("GET", strings.Replace(presigned, "/objects/", "/other/", 1), credential, time.Now()))
+}
+
+func Test_PresignErrors(t *testing.T) {
+	credential := &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}
+	_, err := Presign(newPresignRequest(), &RPCSigner{Credential: credential}, time.Minute)
+	utils.AssertEqual(t, "dara: *dara.RPCSigner does not support presigning", err.Error())
+	_, err = Presign(newPresignRequest(), &ACS3Signer{Credential: credential}, 0)
+	utils.AssertEqual(t, "dara: the expiration of a presigned url must be positive", err.Error())
+	_, err = Presign(NewRequest(), &ACS3Signer{Credential: credential}, time.Minute)
+	utils.AssertEqual(t, "dara: the request to presign has no host header", err.Error())
+	_, err = Presign(newPresignRequest(), &ROASigner{}, time.Minute)
+	utils.AssertEqual(t, "dara: the access key of the signer is empty", err.Error())
+
+	err = VerifyPresignedURL("GET", "https://example.com/?a=b", credential, time.Now())
+	utils.AssertEqual(t, "dara: the url is not presigned", err.Error())
+	err = VerifyPresignedURL("GET", "https://example.com/?x-acs-signature=s&x-acs-credential=ak&x-acs-date=now", credential, time.Now())
+	utils.AssertContains(t, err.Error(), "dara: invalid x-acs-date")
+}
+
+func Test_PresignedURLRequestedByClient(t *testing.T) {
+	credential := &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := VerifyPresignedURL(r.Method, "http://"+r.Host+r.URL.RequestURI(), credential, time.Now())
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	port, _ := strconv.Atoi(serverURL.Port())
+	for _, signer := range []Signer{&ACS3Signer{Credential: credential}, &ROASigner{Credential: credential}} {
+		request := NewRequest()
+		request.Headers["host"] = String(serverURL.Hostname())
+		request.Port = Int(port)
+		request.Pathname = String("/download/report 2024.csv")
+		request.Query["name"] = String("a+b c")
+		presigned, err := Presign(request, signer, time.Minute)
+		utils.AssertNil(t, err)
+		response, err := http.Get(presigned)
+		utils.AssertNil(t, err)
+		body, _ := readAllWithLimit(response.Body, 1024)
+		response.Body.Close()
+		utils.AssertEqual(t, "content", string(body))
+		utils.AssertEqual(t, 200, response.StatusCode)
+	}
+}
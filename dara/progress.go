@@ -0,0 +1,68 @@
+package dara
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+// progressReader publishes a data event of eventType as bytes are read through it
+type progressReader struct {
+	sync.Mutex
+	io.ReadCloser
+	eventType utils.ProgressEventType
+	listener  utils.ProgressListener
+	tracker   *utils.ReaderTracker
+	consumed  int64
+	total     int64
+	interval  time.Duration
+	published time.Time
+	pending   int64
+}
+
+// newProgressReader wraps body. consumed is the number of bytes already
+// transferred and total, 0 when unknown, includes them.
+func newProgressReader(body io.ReadCloser, eventType utils.ProgressEventType, runtime *RuntimeObject,
+	tracker *utils.ReaderTracker, consumed, total int64) *progressReader {
+	return &progressReader{
+		ReadCloser: body,
+		eventType:  eventType,
+		listener:   runtime.Listener,
+		tracker:    tracker,
+		consumed:   consumed,
+		total:      total,
+		interval:   time.Duration(IntValue(runtime.ProgressInterval)) * time.Millisecond,
+	}
+}
+
+func (reader *progressReader) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	if n <= 0 && err == nil {
+		return
+	}
+	reader.Lock()
+	defer reader.Unlock()
+	reader.consumed += int64(n)
+	reader.pending += int64(n)
+	if reader.total > 0 && reader.consumed > reader.total {
+		// the body is longer than its content-length said
+		reader.total = reader.consumed
+	}
+	if reader.tracker != nil {
+		reader.tracker.AddCompletedBytes(int64(n))
+	}
+	now := time.Now()
+	if err == nil && reader.interval > 0 && now.Sub(reader.published) < reader.interval {
+		return
+	}
+	if reader.pending == 0 {
+		return
+	}
+	event := utils.NewProgressEvent(reader.eventType, reader.consumed, reader.total, reader.pending)
+	reader.published = now
+	reader.pending = 0
+	utils.PublishProgress(reader.listener, event)
+	return
+}
@@ -0,0 +1,124 @@
+package dara
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+type recordListener struct {
+	sync.Mutex
+	events []utils.ProgressEvent
+}
+
+func (listener *recordListener) ProgressChanged(event *utils.ProgressEvent) {
+	listener.Lock()
+	defer listener.Unlock()
+	listener.events = append(listener.events, *event)
+}
+
+func (listener *recordListener) dataEvents() []utils.ProgressEvent {
+	listener.Lock()
+	defer listener.Unlock()
+	result := make([]utils.ProgressEvent, 0)
+	for _, event := range listener.events {
+		if event.EventType == utils.TransferDataEvent || event.EventType == utils.ResponseDataEvent {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+type chunkReader struct {
+	data  string
+	chunk int
+}
+
+func (reader *chunkReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:reader.chunk], reader.data)
+	reader.data = reader.data[n:]
+	return n, nil
+}
+
+func Test_DoRequestWithProgress(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			buf := make([]byte, 4)
+			for {
+				_, err := req.Body.Read(buf)
+				if err != nil {
+					break
+				}
+			}
+			res, err := mockResponse(200, "downloaded", nil)
+			res.ContentLength = 10
+			return res, err
+		}
+	}
+
+	listener := &recordListener{}
+	tracker := &utils.ReaderTracker{CompletedBytes: 2}
+	request := NewRequest()
+	request.Method = String("PUT")
+	request.Body = strings.NewReader("uploaded")
+	resp, err := DoRequest(request, &RuntimeObject{Listener: listener, Tracker: tracker})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, int64(10), tracker.CompletedBytes)
+
+	events := listener.dataEvents()
+	utils.AssertEqual(t, 2, len(events))
+	// the total includes the 2 bytes the tracker already counted
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 6, TotalBytes: 10, RwBytes: 4, EventType: utils.TransferDataEvent}, events[0])
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 10, TotalBytes: 10, RwBytes: 4, EventType: utils.TransferDataEvent}, events[1])
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 2, TotalBytes: 10, EventType: utils.TransferStartedEvent}, listener.events[0])
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 10, TotalBytes: 10, EventType: utils.TransferCompletedEvent}, listener.events[3])
+
+	body, err := resp.ReadBody()
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "downloaded", string(body))
+	events = listener.dataEvents()
+	utils.AssertEqual(t, 3, len(events))
+	// the response body is counted apart from the request body
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 10, TotalBytes: 10, RwBytes: 10, EventType: utils.ResponseDataEvent}, events[2])
+}
+
+func Test_progressReaderThrottle(t *testing.T) {
+	listener := &recordListener{}
+	runtime := &RuntimeObject{Listener: listener, ProgressInterval: Int(1000)}
+	reader := newProgressReader(ioutil.NopCloser(&chunkReader{data: "0123456789", chunk: 2}), utils.TransferDataEvent, runtime, nil, 0, 10)
+	byt, err := ioutil.ReadAll(reader)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "0123456789", string(byt))
+	events := listener.dataEvents()
+	// the first read and the rest at EOF
+	utils.AssertEqual(t, 2, len(events))
+	utils.AssertEqual(t, int64(2), events[0].RwBytes)
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 10, TotalBytes: 10, RwBytes: 8, EventType: utils.TransferDataEvent}, events[1])
+
+	listener = &recordListener{}
+	runtime.Listener = listener
+	runtime.ProgressInterval = nil
+	reader = newProgressReader(ioutil.NopCloser(&chunkReader{data: "0123456789", chunk: 2}), utils.TransferDataEvent, runtime, nil, 0, 10)
+	ioutil.ReadAll(reader)
+	utils.AssertEqual(t, 5, len(listener.dataEvents()))
+	utils.AssertEqual(t, true, time.Since(reader.published) < time.Second)
+
+	// a body longer than its content-length never reports more consumed than total
+	listener = &recordListener{}
+	runtime.Listener = listener
+	reader = newProgressReader(ioutil.NopCloser(strings.NewReader("0123456789")), utils.ResponseDataEvent, runtime, nil, 0, 4)
+	ioutil.ReadAll(reader)
+	events = listener.dataEvents()
+	utils.AssertEqual(t, utils.ProgressEvent{ConsumedBytes: 10, TotalBytes: 10, RwBytes: 10, EventType: utils.ResponseDataEvent}, events[0])
+}
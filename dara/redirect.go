@@ -0,0 +1,62 @@
+package dara
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxRedirects is the number of redirects followed when RedirectPolicy.MaxRedirects is not set
+const DefaultMaxRedirects = 10
+
+// RedirectPolicy controls how DoRequest follows redirects. Redirects which
+// are not followed are returned to the caller as they are.
+type RedirectPolicy struct {
+	// Disabled returns every redirect response to the caller
+	Disabled bool
+	// MaxRedirects is the number of redirects followed before DoRequest fails
+	MaxRedirects int
+	// SameHost only follows redirects to the host of the first request
+	SameHost bool
+	// BeforeRedirect is called before following a redirect, it may sign req
+	// again. via holds the requests already sent, oldest first. An error stops
+	// the redirects and is returned by DoRequest.
+	BeforeRedirect func(req *http.Request, via []*http.Request) error
+}
+
+type redirectPolicyKey struct{}
+
+// withRedirectPolicy attaches policy to httpRequest for checkRedirect
+func withRedirectPolicy(httpRequest *http.Request, policy *RedirectPolicy) *http.Request {
+	if policy == nil {
+		return httpRequest
+	}
+	return httpRequest.WithContext(context.WithValue(httpRequest.Context(), redirectPolicyKey{}, policy))
+}
+
+// checkRedirect is the CheckRedirect of the pooled clients, it applies the
+// policy carried by the request context
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	policy, _ := req.Context().Value(redirectPolicyKey{}).(*RedirectPolicy)
+	if policy == nil {
+		policy = &RedirectPolicy{}
+	}
+	if policy.Disabled {
+		return http.ErrUseLastResponse
+	}
+	maxRedirects := policy.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("dara: stopped after %d redirects", maxRedirects)
+	}
+	if policy.SameHost && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		return http.ErrUseLastResponse
+	}
+	if policy.BeforeRedirect != nil {
+		return policy.BeforeRedirect(req, via)
+	}
+	return nil
+}
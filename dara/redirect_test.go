@@ -0,0 +1,107 @@
+package dara
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func newRedirectRequest(t *testing.T, rawURL string, policy *RedirectPolicy) *http.Request {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	utils.AssertNil(t, err)
+	return withRedirectPolicy(req, policy)
+}
+
+func Test_checkRedirect(t *testing.T) {
+	first := newRedirectRequest(t, "http://a.example.com/", nil)
+	via := []*http.Request{first}
+	utils.AssertNil(t, checkRedirect(newRedirectRequest(t, "http://b.example.com/", nil), via))
+	many := make([]*http.Request, 10)
+	for i := range many {
+		many[i] = first
+	}
+	err := checkRedirect(newRedirectRequest(t, "http://a.example.com/", nil), many)
+	utils.AssertEqual(t, "dara: stopped after 10 redirects", err.Error())
+
+	policy := &RedirectPolicy{Disabled: true}
+	utils.AssertEqual(t, http.ErrUseLastResponse, checkRedirect(newRedirectRequest(t, "http://a.example.com/", policy), via))
+
+	policy = &RedirectPolicy{MaxRedirects: 1}
+	err = checkRedirect(newRedirectRequest(t, "http://a.example.com/", policy), via)
+	utils.AssertEqual(t, "dara: stopped after 1 redirects", err.Error())
+
+	policy = &RedirectPolicy{SameHost: true}
+	utils.AssertNil(t, checkRedirect(newRedirectRequest(t, "http://A.example.com/next", policy), via))
+	utils.AssertEqual(t, http.ErrUseLastResponse, checkRedirect(newRedirectRequest(t, "http://b.example.com/", policy), via))
+
+	policy = &RedirectPolicy{BeforeRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != via[0].URL.Host {
+			return errors.New("cross host")
+		}
+		req.Header.Set("Authorization", "signed "+req.URL.Path)
+		return nil
+	}}
+	req := newRedirectRequest(t, "http://a.example.com/next", policy)
+	utils.AssertNil(t, checkRedirect(req, via))
+	utils.AssertEqual(t, "signed /next", req.Header.Get("Authorization"))
+	utils.AssertEqual(t, "cross host", checkRedirect(newRedirectRequest(t, "http://b.example.com/", policy), via).Error())
+}
+
+func Test_DoRequestWithRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "other host")
+	}))
+	defer other.Close()
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/next", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, other.URL+"/", http.StatusFound)
+		default:
+			fmt.Fprint(w, "same host")
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	send := func(path string, policy *RedirectPolicy) (int, string) {
+		request := NewRequest()
+		request.Headers["host"] = String(serverURL.Host)
+		request.Headers["authorization"] = String("signed /start")
+		request.Pathname = String(path)
+		response, err := DoRequest(request, &RuntimeObject{RedirectPolicy: policy})
+		utils.AssertNil(t, err)
+		body, _ := ReadAsString(response.Body)
+		return IntValue(response.StatusCode), body
+	}
+
+	code, body := send("/start", nil)
+	utils.AssertEqual(t, 200, code)
+	utils.AssertEqual(t, "same host", body)
+
+	code, _ = send("/start", &RedirectPolicy{Disabled: true})
+	utils.AssertEqual(t, 302, code)
+
+	code, _ = send("/away", &RedirectPolicy{SameHost: true})
+	utils.AssertEqual(t, 302, code)
+	code, body = send("/away", nil)
+	utils.AssertEqual(t, 200, code)
+	utils.AssertEqual(t, "other host", body)
+
+	authorizations = nil
+	code, _ = send("/start", &RedirectPolicy{BeforeRedirect: func(req *http.Request, via []*http.Request) error {
+		req.Header.Set("Authorization", "signed "+req.URL.Path)
+		return nil
+	}})
+	utils.AssertEqual(t, 200, code)
+	utils.AssertEqual(t, "signed /start,signed /next", strings.Join(authorizations, ","))
+}
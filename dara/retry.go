@@ -20,6 +20,18 @@ type RetryPolicyContext struct {
 	HttpRequest      *Request  // placeholder for actual http.Request type
 	HttpResponse     *Response // placeholder for actual http.Response type
 	Exception        error
+	// IdempotencyToken is the client token shared by the attempts of the call,
+	// generated by ShouldRetry for the first attempt and carried over from HttpRequest
+	IdempotencyToken string
+}
+
+// SetRetryPolicyContext makes request the attempt of a call which ctx, given
+// to ShouldRetry, follows: it sends the client token of ctx and, when its Body
+// is the reader ctx.HttpRequest was given, the body ctx.HttpRequest kept for
+// sending again, from where it started
+func (request *Request) SetRetryPolicyContext(ctx *RetryPolicyContext) {
+	request.SetIdempotencyToken(ctx.IdempotencyToken)
+	request.takeBody(ctx.HttpRequest)
 }
 
 // BackoffPolicy interface with a method to get delay time
@@ -258,6 +270,13 @@ func NewRetryOptions(options map[string]interface{}) *RetryOptions {
 
 // shouldRetry determines if a retry should be attempted
 func ShouldRetry(options *RetryOptions, ctx *RetryPolicyContext) bool {
+	if ctx.IdempotencyToken == "" {
+		if ctx.HttpRequest != nil {
+			ctx.IdempotencyToken = ctx.HttpRequest.idempotencyToken
+		} else if ctx.RetriesAttempted == 0 {
+			ctx.IdempotencyToken = newUUID()
+		}
+	}
 	if ctx.RetriesAttempted == 0 {
 		return true
 	}
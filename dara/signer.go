@@ -0,0 +1,417 @@
+package dara
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureRPC is the algorithm of RPCSigner
+	SignatureRPC = "HMAC-SHA1"
+	// SignatureACS3 is the algorithm of ACS3Signer
+	SignatureACS3 = "ACS3-HMAC-SHA256"
+	// SignatureROA is the algorithm of ROASigner
+	SignatureROA = "acs"
+)
+
+const iso8601Format = "2006-01-02T15:04:05Z"
+
+// Credential is the access key a request is signed with
+type Credential struct {
+	AccessKeyId     string
+	AccessKeySecret string
+	// SecurityToken is set for temporary credentials
+	SecurityToken string
+	// Expiration is zero for credentials which do not expire
+	Expiration time.Time
+}
+
+// SigningContext holds what a signer needs besides the request
+type SigningContext struct {
+	// Time is the signing time
+	Time time.Time
+	// Nonce is a value unique to this attempt
+	Nonce string
+	// HeaderCase is the header case policy the request is sent with
+	HeaderCase string
+	// Context bounds the wait for the credential, context.Background when nil
+	Context context.Context
+}
+
+// SignatureInfo describes a signature for debugging
+type SignatureInfo struct {
+	Algorithm string
+	// CanonicalRequest is empty for algorithms which sign the string directly
+	CanonicalRequest string
+	StringToSign     string
+	Signature        string
+}
+
+// Signer signs a request. DoRequest calls it just before the request is sent,
+// after the body is compressed, with a new SigningContext on every call.
+type Signer interface {
+	Sign(request *Request, context *SigningContext) error
+}
+
+// newSigningContext returns the context of request, its time corrected with
+// the clock offset of the endpoint
+func newSigningContext(request *Request, runtimeObject *RuntimeObject) *SigningContext {
+	now := time.Now()
+	if !BoolValue(runtimeObject.DisableClockSkewCorrection) {
+		now = ServerTime(StringValue(request.Domain))
+	}
+	return &SigningContext{
+		Time:       now,
+		Nonce:      newUUID(),
+		HeaderCase: StringValue(runtimeObject.HeaderCase),
+	}
+}
+
+// signRequest sets the client token of request and signs it with the signer of runtimeObject
+func signRequest(request *Request, runtimeObject *RuntimeObject) error {
+	if err := injectIdempotencyToken(request, runtimeObject); err != nil {
+		return err
+	}
+	if runtimeObject.Signer == nil {
+		return nil
+	}
+	signingContext := newSigningContext(request, runtimeObject)
+	// the credential is waited for no longer than the request itself
+	if timeout := IntValue(runtimeObject.ConnectTimeout) + IntValue(runtimeObject.ReadTimeout); timeout > 0 {
+		var cancel context.CancelFunc
+		signingContext.Context, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+	return runtimeObject.Signer.Sign(request, signingContext)
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func checkCredential(credential *Credential) error {
+	if credential == nil || credential.AccessKeyId == "" || credential.AccessKeySecret == "" {
+		return errors.New("dara: the access key of the signer is empty")
+	}
+	return nil
+}
+
+func hmacSum(newHash func() hash.Hash, key, data string) []byte {
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signedHeaders returns the values of the headers sent with request keyed by
+// their lowercase name, multiple values joined with a comma
+func signedHeaders(request *Request, headerCase string) map[string]string {
+	headers := make(map[string]string)
+	for _, field := range WireHeaders(request, headerCase) {
+		name := strings.ToLower(field.Name)
+		if value, ok := headers[name]; ok {
+			headers[name] = value + "," + strings.TrimSpace(field.Value)
+			continue
+		}
+		headers[name] = strings.TrimSpace(field.Value)
+	}
+	return headers
+}
+
+func debugSignature(debug func(*SignatureInfo), info *SignatureInfo) {
+	debugLog("> %s string to sign: %q", info.Algorithm, info.StringToSign)
+	if debug != nil {
+		debug(info)
+	}
+}
+
+// RPCSigner signs the query string of RPC style APIs with HMAC-SHA1, signature
+// version 1.0. Parameters of an application/x-www-form-urlencoded body are
+// signed too.
+type RPCSigner struct {
+	Credential *Credential
+	// Credentials is used instead of Credential when it is set
+	Credentials CredentialsProvider
+	// Debug receives the string to sign of every signature
+	Debug func(info *SignatureInfo)
+}
+
+// Sign sets the signature parameters and the Signature in the query of request
+func (signer *RPCSigner) Sign(request *Request, context *SigningContext) error {
+	credential, err := resolveCredential(context, signer.Credential, signer.Credentials)
+	if err != nil {
+		return err
+	}
+	if request.Query == nil {
+		request.Query = make(map[string]*string)
+	}
+	delete(request.Query, "Signature")
+	request.Query["SignatureMethod"] = String(SignatureRPC)
+	request.Query["SignatureVersion"] = String("1.0")
+	request.Query["SignatureNonce"] = String(context.Nonce)
+	request.Query["Timestamp"] = String(context.Time.UTC().Format(iso8601Format))
+	request.Query["AccessKeyId"] = String(credential.AccessKeyId)
+	if credential.SecurityToken != "" {
+		request.Query["SecurityToken"] = String(credential.SecurityToken)
+	}
+
+	params := make(map[string][]string)
+	for key, value := range request.Query {
+		if value != nil {
+			params[key] = append([]string{*value}, request.extraQuery[key]...)
+		}
+	}
+	contentType := getHeaderValue(request.Headers, "content-type")
+	if request.Body != nil && strings.HasPrefix(strings.ToLower(contentType), "application/x-www-form-urlencoded") {
+		byt, err := readBodyBytes(request)
+		if err != nil {
+			return err
+		}
+		form, err := url.ParseQuery(string(byt))
+		if err != nil {
+			return err
+		}
+		for key, values := range form {
+			params[key] = append(params[key], values...)
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range params[key] {
+			pairs = append(pairs, PercentEncode(key)+"="+PercentEncode(value))
+		}
+	}
+
+	stringToSign := signingMethod(request) + "&" + PercentEncode("/") + "&" + PercentEncode(strings.Join(pairs, "&"))
+	signature := base64.StdEncoding.EncodeToString(hmacSum(sha1.New, credential.AccessKeySecret+"&", stringToSign))
+	request.Query["Signature"] = String(signature)
+	debugSignature(signer.Debug, &SignatureInfo{Algorithm: SignatureRPC, StringToSign: stringToSign, Signature: signature})
+	return nil
+}
+
+// ACS3Signer signs requests with the ACS3-HMAC-SHA256 signature, covering the
+// method, path, query, the host, content-type and x-acs-* headers and the body.
+type ACS3Signer struct {
+	Credential *Credential
+	// Credentials is used instead of Credential when it is set
+	Credentials CredentialsProvider
+	// SignedHeaders are signed in addition to the default ones
+	SignedHeaders []string
+	// Debug receives the canonical request and string to sign of every signature
+	Debug func(info *SignatureInfo)
+}
+
+// Sign sets the x-acs-* headers and the Authorization header of request. An
+// x-acs-content-sha256 header already set is used as the hash of the body.
+func (signer *ACS3Signer) Sign(request *Request, context *SigningContext) error {
+	credential, err := resolveCredential(context, signer.Credential, signer.Credentials)
+	if err != nil {
+		return err
+	}
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	for name := range request.Headers {
+		if strings.EqualFold(name, "authorization") {
+			delete(request.Headers, name)
+		}
+	}
+	if getHeaderValue(request.Headers, "host") == "" && request.Domain != nil {
+		request.Headers["host"] = String(StringValue(request.Domain))
+	}
+	setHeaderValue(request.Headers, "x-acs-date", context.Time.UTC().Format(iso8601Format))
+	setHeaderValue(request.Headers, "x-acs-signature-nonce", context.Nonce)
+	if credential.SecurityToken != "" {
+		setHeaderValue(request.Headers, "x-acs-security-token", credential.SecurityToken)
+	}
+	payloadHash := getHeaderValue(request.Headers, "x-acs-content-sha256")
+	if payloadHash == "" {
+		if err := SetRequestChecksum(request, ChecksumSHA256, "x-acs-content-sha256"); err != nil {
+			return err
+		}
+		payloadHash = StringValue(request.Headers["x-acs-content-sha256"])
+	}
+
+	extra := make(map[string]bool, len(signer.SignedHeaders))
+	for _, name := range signer.SignedHeaders {
+		extra[strings.ToLower(name)] = true
+	}
+	headers := signedHeaders(request, context.HeaderCase)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if name == "host" || name == "content-type" || strings.HasPrefix(name, "x-acs-") || extra[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedNames := strings.Join(names, ";")
+
+	canonicalRequest, stringToSign, signature := acs3Signature(credential, request, canonicalHeaders.String(), signedNames, payloadHash)
+	request.Headers["Authorization"] = String(fmt.Sprintf("%s Credential=%s,SignedHeaders=%s,Signature=%s",
+		SignatureACS3, credential.AccessKeyId, signedNames, signature))
+	debugSignature(signer.Debug, &SignatureInfo{
+		Algorithm:        SignatureACS3,
+		CanonicalRequest: canonicalRequest,
+		StringToSign:     stringToSign,
+		Signature:        signature,
+	})
+	return nil
+}
+
+// acs3Signature returns the canonical request, string to sign and signature of request
+func acs3Signature(credential *Credential, request *Request, canonicalHeaders, signedNames, payloadHash string) (string, string, string) {
+	canonicalRequest := strings.Join([]string{
+		signingMethod(request),
+		canonicalPath(StringValue(request.Pathname)),
+		CanonicalQueryString(request),
+		canonicalHeaders,
+		signedNames,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := SignatureACS3 + "\n" + hex.EncodeToString(requestHash[:])
+	signature := hex.EncodeToString(hmacSum(sha256.New, credential.AccessKeySecret, stringToSign))
+	return canonicalRequest, stringToSign, signature
+}
+
+// canonicalPath encodes pathname with PathEncode, a pathname already encoded
+// is decoded first so that it is not encoded twice
+func canonicalPath(pathname string) string {
+	if pathname == "" {
+		return "/"
+	}
+	if decoded, err := url.PathUnescape(pathname); err == nil {
+		pathname = decoded
+	}
+	return PathEncode(pathname)
+}
+
+// signingMethod returns the upper case method of request, GET by default
+func signingMethod(request *Request) string {
+	method := strings.ToUpper(StringValue(request.Method))
+	if method == "" {
+		method = "GET"
+	}
+	return method
+}
+
+// ROASigner signs ROA style APIs with an HMAC-SHA1 signature of the method,
+// the accept, content-md5, content-type and date headers, the x-acs-* headers
+// and the resource, sent as "Authorization: acs AccessKeyId:Signature".
+type ROASigner struct {
+	Credential *Credential
+	// Credentials is used instead of Credential when it is set
+	Credentials CredentialsProvider
+	// Debug receives the string to sign of every signature
+	Debug func(info *SignatureInfo)
+}
+
+// Sign sets the date, x-acs-signature-* and Authorization headers of request.
+// The content-md5 header is computed for a body without one.
+func (signer *ROASigner) Sign(request *Request, context *SigningContext) error {
+	credential, err := resolveCredential(context, signer.Credential, signer.Credentials)
+	if err != nil {
+		return err
+	}
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	for name := range request.Headers {
+		if strings.EqualFold(name, "authorization") {
+			delete(request.Headers, name)
+		}
+	}
+	setHeaderValue(request.Headers, "date", context.Time.UTC().Format(http.TimeFormat))
+	setHeaderValue(request.Headers, "x-acs-signature-method", SignatureRPC)
+	setHeaderValue(request.Headers, "x-acs-signature-version", "1.0")
+	setHeaderValue(request.Headers, "x-acs-signature-nonce", context.Nonce)
+	if credential.SecurityToken != "" {
+		setHeaderValue(request.Headers, "x-acs-security-token", credential.SecurityToken)
+	}
+	if request.Body != nil && getHeaderValue(request.Headers, "content-md5") == "" {
+		if err := SetRequestChecksum(request, ChecksumMD5, "content-md5"); err != nil {
+			return err
+		}
+	}
+
+	headers := signedHeaders(request, context.HeaderCase)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if strings.HasPrefix(name, "x-acs-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var stringToSign strings.Builder
+	stringToSign.WriteString(signingMethod(request) + "\n")
+	for _, name := range []string{"accept", "content-md5", "content-type", "date"} {
+		stringToSign.WriteString(headers[name] + "\n")
+	}
+	for _, name := range names {
+		stringToSign.WriteString(name + ":" + headers[name] + "\n")
+	}
+	stringToSign.WriteString(roaResource(request))
+
+	signature := base64.StdEncoding.EncodeToString(hmacSum(sha1.New, credential.AccessKeySecret, stringToSign.String()))
+	request.Headers["Authorization"] = String("acs " + credential.AccessKeyId + ":" + signature)
+	debugSignature(signer.Debug, &SignatureInfo{Algorithm: SignatureROA, StringToSign: stringToSign.String(), Signature: signature})
+	return nil
+}
+
+// roaResource returns the path of request followed by its query sorted by key,
+// not encoded, a key without value written alone
+func roaResource(request *Request) string {
+	keys := make([]string, 0, len(request.Query))
+	for key := range request.Query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := request.Query[key]
+		values := []string{StringValue(value)}
+		if value != nil {
+			values = append(values, request.extraQuery[key]...)
+		}
+		for _, v := range values {
+			if v == "" {
+				pairs = append(pairs, key)
+			} else {
+				pairs = append(pairs, key+"="+v)
+			}
+		}
+	}
+	resource := StringValue(request.Pathname)
+	if len(pairs) > 0 {
+		resource += "?" + strings.Join(pairs, "&")
+	}
+	return resource
+}
@@ -0,0 +1,232 @@
+package dara
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func signingTime(t *testing.T, value string) time.Time {
+	signed, err := time.Parse(iso8601Format, value)
+	utils.AssertNil(t, err)
+	return signed
+}
+
+func Test_RPCSigner(t *testing.T) {
+	request := NewRequest()
+	request.Query["Action"] = String("DescribeRegions")
+	request.Query["Format"] = String("XML")
+	request.Query["Version"] = String("2014-05-26")
+	var info *SignatureInfo
+	signer := &RPCSigner{
+		Credential: &Credential{AccessKeyId: "testid", AccessKeySecret: "testsecret"},
+		Debug:      func(signature *SignatureInfo) { info = signature },
+	}
+	err := signer.Sign(request, &SigningContext{
+		Time:  signingTime(t, "2016-02-23T12:46:24Z"),
+		Nonce: "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf",
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "GET&%2F&AccessKeyId%3Dtestid%26Action%3DDescribeRegions%26Format%3DXML"+
+		"%26SignatureMethod%3DHMAC-SHA1%26SignatureNonce%3D3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf"+
+		"%26SignatureVersion%3D1.0%26Timestamp%3D2016-02-23T12%253A46%253A24Z%26Version%3D2014-05-26", info.StringToSign)
+	utils.AssertEqual(t, "OLeaidS1JvxuMvnyHOwuJ+uX5qY=", StringValue(request.Query["Signature"]))
+	utils.AssertEqual(t, "OLeaidS1JvxuMvnyHOwuJ+uX5qY=", info.Signature)
+	utils.AssertEqual(t, "2016-02-23T12:46:24Z", StringValue(request.Query["Timestamp"]))
+
+	// signing again replaces the signature
+	err = signer.Sign(request, &SigningContext{Time: signingTime(t, "2016-02-23T12:46:24Z"), Nonce: "other"})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "other", StringValue(request.Query["SignatureNonce"]))
+	utils.AssertEqual(t, false, strings.Contains(info.StringToSign, "Signature%3D"))
+
+	// parameters of a form body and a security token are signed
+	request = NewRequest()
+	request.Method = String("POST")
+	request.Query["Action"] = String("RunInstances")
+	request.Headers["content-type"] = String("application/x-www-form-urlencoded")
+	request.Body = strings.NewReader("InstanceName=a%20b&Tag.1=x")
+	signer.Credential.SecurityToken = "token"
+	utils.AssertNil(t, signer.Sign(request, &SigningContext{Time: signingTime(t, "2024-01-02T03:04:05Z"), Nonce: "n"}))
+	utils.AssertEqual(t, "POST&%2F&AccessKeyId%3Dtestid%26Action%3DRunInstances%26InstanceName%3Da%2520b"+
+		"%26SecurityToken%3Dtoken%26SignatureMethod%3DHMAC-SHA1%26SignatureNonce%3Dn%26SignatureVersion%3D1.0"+
+		"%26Tag.1%3Dx%26Timestamp%3D2024-01-02T03%253A04%253A05Z", info.StringToSign)
+	utils.AssertEqual(t, "token", StringValue(request.Query["SecurityToken"]))
+	body, _ := ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, "InstanceName=a%20b&Tag.1=x", string(body))
+
+	err = (&RPCSigner{}).Sign(NewRequest(), &SigningContext{})
+	utils.AssertEqual(t, "dara: the access key of the signer is empty", err.Error())
+}
+
+func Test_ACS3Signer(t *testing.T) {
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Pathname = String("/")
+	request.Query["ImageId"] = String("win2019_1809_x64_dtc_zh-cn_40G_alibase_20230811.vhd")
+	request.Query["RegionId"] = String("cn-shanghai")
+	request.Headers["host"] = String("ecs.cn-shanghai.aliyuncs.com")
+	request.Headers["x-acs-action"] = String("RunInstances")
+	request.Headers["x-acs-version"] = String("2014-05-26")
+	var info *SignatureInfo
+	signer := &ACS3Signer{
+		Credential: &Credential{AccessKeyId: "YourAccessKeyId", AccessKeySecret: "YourAccessKeySecret"},
+		Debug:      func(signature *SignatureInfo) { info = signature },
+	}
+	err := signer.Sign(request, &SigningContext{
+		Time:  signingTime(t, "2023-10-26T10:22:32Z"),
+		Nonce: "3156853299f313e23d1673dc12e1703d",
+	})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "POST\n/\n"+
+		"ImageId=win2019_1809_x64_dtc_zh-cn_40G_alibase_20230811.vhd&RegionId=cn-shanghai\n"+
+		"host:ecs.cn-shanghai.aliyuncs.com\n"+
+		"x-acs-action:RunInstances\n"+
+		"x-acs-content-sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n"+
+		"x-acs-date:2023-10-26T10:22:32Z\n"+
+		"x-acs-signature-nonce:3156853299f313e23d1673dc12e1703d\n"+
+		"x-acs-version:2014-05-26\n\n"+
+		"host;x-acs-action;x-acs-content-sha256;x-acs-date;x-acs-signature-nonce;x-acs-version\n"+
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", info.CanonicalRequest)
+	utils.AssertEqual(t, "ACS3-HMAC-SHA256\n7ea06492da5221eba5297e897ce16e55f964061054b7695beedaac1145b1e259", info.StringToSign)
+	utils.AssertEqual(t, "ACS3-HMAC-SHA256 Credential=YourAccessKeyId,"+
+		"SignedHeaders=host;x-acs-action;x-acs-content-sha256;x-acs-date;x-acs-signature-nonce;x-acs-version,"+
+		"Signature=06563a9e1b43f5dfe96b81484da74bceab24a1d853912eee15083a6f0f3283c0", StringValue(request.Headers["Authorization"]))
+
+	// extra signed headers, multiple values, a body and an encoded path
+	request = NewRequest()
+	request.Method = String("PUT")
+	request.Pathname = String("/a b/c*")
+	request.Domain = String("example.com")
+	request.Query["tag"] = String("x y")
+	request.AddQuery("tag", "z")
+	request.Headers["Content-Type"] = String("application/json")
+	request.Headers["X-Acs-Meta"] = String(" 1 ")
+	request.AddHeader("X-Acs-Meta", "2")
+	request.Headers["x-custom"] = String("v")
+	request.Body = strings.NewReader(`{"a":1}`)
+	signer.SignedHeaders = []string{"X-Custom"}
+	signer.Credential.SecurityToken = "token"
+	utils.AssertNil(t, signer.Sign(request, &SigningContext{Time: signingTime(t, "2024-01-02T03:04:05Z"), Nonce: "n"}))
+	sum := sha256.Sum256([]byte(`{"a":1}`))
+	utils.AssertEqual(t, "PUT\n/a%20b/c%2A\ntag=x%20y&tag=z\n"+
+		"content-type:application/json\n"+
+		"host:example.com\n"+
+		"x-acs-content-sha256:"+hex.EncodeToString(sum[:])+"\n"+
+		"x-acs-date:2024-01-02T03:04:05Z\n"+
+		"x-acs-meta:1,2\n"+
+		"x-acs-security-token:token\n"+
+		"x-acs-signature-nonce:n\n"+
+		"x-custom:v\n\n"+
+		"content-type;host;x-acs-content-sha256;x-acs-date;x-acs-meta;x-acs-security-token;x-acs-signature-nonce;x-custom\n"+
+		hex.EncodeToString(sum[:]), info.CanonicalRequest)
+	body, _ := ioutil.ReadAll(request.Body)
+	utils.AssertEqual(t, `{"a":1}`, string(body))
+
+	// a given payload hash is kept
+	request = NewRequest()
+	request.Headers["x-acs-content-sha256"] = String("UNSIGNED-PAYLOAD")
+	request.Body = strings.NewReader("stream")
+	utils.AssertNil(t, signer.Sign(request, &SigningContext{Time: time.Now(), Nonce: "n"}))
+	utils.AssertEqual(t, true, strings.HasSuffix(info.CanonicalRequest, "\nUNSIGNED-PAYLOAD"))
+}
+
+func Test_ROASigner(t *testing.T) {
+	request := NewRequest()
+	request.Method = String("POST")
+	request.Pathname = String("/clusters")
+	request.Query["RegionId"] = String("cn-hangzhou")
+	request.Query["dryRun"] = String("")
+	request.Headers["host"] = String("cs.aliyuncs.com")
+	request.Headers["accept"] = String("application/json")
+	request.Headers["content-type"] = String("application/json")
+	request.Headers["x-acs-version"] = String("2015-12-15")
+	request.Body = strings.NewReader(`{"name":"test"}`)
+	var info *SignatureInfo
+	signer := &ROASigner{
+		Credential: &Credential{AccessKeyId: "testid", AccessKeySecret: "testsecret", SecurityToken: "token"},
+		Debug:      func(signature *SignatureInfo) { info = signature },
+	}
+	err := signer.Sign(request, &SigningContext{Time: signingTime(t, "2024-01-02T03:04:05Z"), Nonce: "nonce-1"})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "POST\napplication/json\nK4lbbvqii4GChOXGlqGHmQ==\napplication/json\nTue, 02 Jan 2024 03:04:05 GMT\n"+
+		"x-acs-security-token:token\nx-acs-signature-method:HMAC-SHA1\nx-acs-signature-nonce:nonce-1\n"+
+		"x-acs-signature-version:1.0\nx-acs-version:2015-12-15\n/clusters?RegionId=cn-hangzhou&dryRun", info.StringToSign)
+	utils.AssertEqual(t, "acs testid:ZRRhdA/PsGmC3oKFvuDkE48M928=", StringValue(request.Headers["Authorization"]))
+	utils.AssertEqual(t, "K4lbbvqii4GChOXGlqGHmQ==", StringValue(request.Headers["content-md5"]))
+	utils.AssertEqual(t, "Tue, 02 Jan 2024 03:04:05 GMT", StringValue(request.Headers["date"]))
+
+	request = NewRequest()
+	request.Pathname = String("/regions")
+	utils.AssertNil(t, signer.Sign(request, &SigningContext{Time: signingTime(t, "2024-01-02T03:04:05Z"), Nonce: "n"}))
+	utils.AssertEqual(t, true, strings.HasPrefix(info.StringToSign, "GET\n\n\n\nTue, 02 Jan 2024 03:04:05 GMT\n"))
+	utils.AssertEqual(t, true, strings.HasSuffix(info.StringToSign, "\n/regions"))
+	utils.AssertNil(t, request.Headers["content-md5"])
+}
+
+func Test_DoRequestWithSigner(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var sent *http.Request
+	var sentBody []byte
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			sent = req
+			sentBody = nil
+			if req.Body != nil {
+				sentBody, _ = ioutil.ReadAll(req.Body)
+			}
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+
+	var infos []*SignatureInfo
+	credential := &Credential{AccessKeyId: "ak", AccessKeySecret: "sk"}
+	request := NewRequest()
+	request.Query["Action"] = String("Describe")
+	request.Query["Name"] = String("a b")
+	runtime := NewRuntimeObject(map[string]interface{}{
+		"signer": &RPCSigner{Credential: credential, Debug: func(info *SignatureInfo) { infos = append(infos, info) }},
+	})
+	_, err := DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	query := sent.URL.Query()
+	utils.AssertEqual(t, StringValue(request.Query["Signature"]), query.Get("Signature"))
+	utils.AssertEqual(t, 36, len(query.Get("SignatureNonce")))
+	utils.AssertEqual(t, true, strings.Contains(sent.URL.RawQuery, "Name=a%20b"))
+
+	// every call is signed with a new nonce
+	_, err = DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, 2, len(infos))
+	utils.AssertEqual(t, false, query.Get("SignatureNonce") == sent.URL.Query().Get("SignatureNonce"))
+
+	// the signature covers the compressed body and the headers as sent
+	payload := strings.Repeat("compressible ", 100)
+	request = NewRequest()
+	request.Method = String("POST")
+	request.Headers["content-type"] = String("text/plain")
+	request.Headers["X-Acs-Action"] = String("Put")
+	request.Body = strings.NewReader(payload)
+	runtime = &RuntimeObject{
+		Signer:             &ACS3Signer{Credential: credential, Debug: func(info *SignatureInfo) { infos = append(infos, info) }},
+		RequestCompression: String(EncodingGzip),
+		HeaderCase:         String(HeaderCaseLowercase),
+	}
+	_, err = DoRequest(request, runtime)
+	utils.AssertNil(t, err)
+	sum := sha256.Sum256(sentBody)
+	utils.AssertEqual(t, hex.EncodeToString(sum[:]), strings.Join(sent.Header["x-acs-content-sha256"], ""))
+	utils.AssertEqual(t, EncodingGzip, strings.Join(sent.Header["content-encoding"], ""))
+	utils.AssertContains(t, infos[2].CanonicalRequest, "x-acs-action:Put\n")
+	utils.AssertContains(t, strings.Join(sent.Header["authorization"], ""), "Credential=ak,")
+
+	_, err = DoRequest(NewRequest(), &RuntimeObject{Signer: &ROASigner{}})
+	utils.AssertEqual(t, "dara: the access key of the signer is empty", err.Error())
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
-	"io/ioutil"
 	"strings"
 	"fmt"
 )
@@ -49,29 +48,38 @@ func parseEvent(lines []string) *SSEEvent {
 }
 
 func ReadAsBytes(body io.Reader) ([]byte, error) {
-	byt, err := ioutil.ReadAll(body)
+	return ReadAsBytesWithLimit(body, bodySizeLimit(body))
+}
+
+// ReadAsBytesWithLimit returns a *ResponseTooLargeError when body has more than limit bytes
+func ReadAsBytesWithLimit(body io.Reader, limit int64) ([]byte, error) {
+	// the body is closed on errors too, an oversized stream would stay open otherwise
+	if r, ok := body.(io.ReadCloser); ok {
+		defer r.Close()
+	}
+	byt, err := readAllWithLimit(body, limit)
 	if err != nil {
 		return nil, err
 	}
-	r, ok := body.(io.ReadCloser)
-	if ok {
-		r.Close()
-	}
 	return byt, nil
 }
 
 func ReadAsJSON(body io.Reader) (result interface{}, err error) {
-	byt, err := ioutil.ReadAll(body)
+	return ReadAsJSONWithLimit(body, bodySizeLimit(body))
+}
+
+// ReadAsJSONWithLimit returns a *ResponseTooLargeError when body has more than limit bytes
+func ReadAsJSONWithLimit(body io.Reader, limit int64) (result interface{}, err error) {
+	if r, ok := body.(io.ReadCloser); ok {
+		defer r.Close()
+	}
+	byt, err := readAllWithLimit(body, limit)
 	if err != nil {
 		return
 	}
 	if string(byt) == "" {
 		return
 	}
-	r, ok := body.(io.ReadCloser)
-	if ok {
-		r.Close()
-	}
 	d := json.NewDecoder(bytes.NewReader(byt))
 	d.UseNumber()
 	err = d.Decode(&result)
@@ -79,14 +87,18 @@ func ReadAsJSON(body io.Reader) (result interface{}, err error) {
 }
 
 func ReadAsString(body io.Reader) (string, error) {
-	byt, err := ioutil.ReadAll(body)
+	return ReadAsStringWithLimit(body, bodySizeLimit(body))
+}
+
+// ReadAsStringWithLimit returns a *ResponseTooLargeError when body has more than limit bytes
+func ReadAsStringWithLimit(body io.Reader, limit int64) (string, error) {
+	if r, ok := body.(io.ReadCloser); ok {
+		defer r.Close()
+	}
+	byt, err := readAllWithLimit(body, limit)
 	if err != nil {
 		return "", err
 	}
-	r, ok := body.(io.ReadCloser)
-	if ok {
-		r.Close()
-	}
 	return string(byt), nil
 }
 
@@ -3,6 +3,7 @@ package dara
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -147,3 +148,43 @@ func PathEncode(path string) string {
 	path = strings.Replace(path, "%7E", "~", -1)
 	return path
 }
+
+const (
+	// QueryEncodingForm encodes the query string like url.Values, a space is +
+	QueryEncodingForm = "form"
+	// QueryEncodingRFC3986 encodes the query string with PercentEncode, a space is %20
+	QueryEncodingRFC3986 = "rfc3986"
+)
+
+// checkQueryEncoding returns an error when encoding is not a known query encoding
+func checkQueryEncoding(encoding string) error {
+	switch encoding {
+	case "", QueryEncodingForm, QueryEncodingRFC3986:
+		return nil
+	}
+	return fmt.Errorf("dara: unsupported query encoding %q", encoding)
+}
+
+// CanonicalQueryString returns the query of request encoded with PercentEncode,
+// sorted by key with the values of a key in order. It is the query string sent
+// with QueryEncodingRFC3986, so signers use it as is.
+func CanonicalQueryString(request *Request) string {
+	keys := make([]string, 0, len(request.Query))
+	for key := range request.Query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := request.Query[key]
+		pairs = append(pairs, PercentEncode(key)+"="+PercentEncode(StringValue(value)))
+		if value == nil {
+			continue
+		}
+		for _, extra := range request.extraQuery[key] {
+			pairs = append(pairs, PercentEncode(key)+"="+PercentEncode(extra))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
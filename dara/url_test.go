@@ -1,7 +1,12 @@
 package dara
 
 import (
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
 )
 
 func TestNewURL(t *testing.T) {
@@ -253,3 +258,52 @@ func TestPathEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalQueryString(t *testing.T) {
+	request := NewRequest()
+	request.Query["b"] = String("a b*c~d")
+	request.Query["a"] = String("x/y=z")
+	request.Query["empty"] = nil
+	request.AddQuery("tag list", "1")
+	request.AddQuery("tag list", "2 3")
+	utils.AssertEqual(t, "a=x%2Fy%3Dz&b=a%20b%2Ac~d&empty=&tag%20list=1&tag%20list=2%203", CanonicalQueryString(request))
+	utils.AssertEqual(t, "", CanonicalQueryString(NewRequest()))
+}
+
+func TestDoRequestQueryEncoding(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var rawQuery string
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			rawQuery = req.URL.RawQuery
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+
+	newQueryRequest := func() *Request {
+		request := NewRequest()
+		request.Query["Name"] = String("a b")
+		request.Query["Filter"] = String("*")
+		return request
+	}
+	_, err := DoRequest(newQueryRequest(), NewRuntimeObject(map[string]interface{}{}))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "Filter=%2A&Name=a%20b", rawQuery)
+	utils.AssertEqual(t, CanonicalQueryString(newQueryRequest()), rawQuery)
+
+	_, err = DoRequest(newQueryRequest(), NewRuntimeObject(nil))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "Filter=%2A&Name=a%20b", rawQuery)
+
+	_, err = DoRequest(newQueryRequest(), NewRuntimeObject(map[string]interface{}{"queryEncoding": QueryEncodingForm}))
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "Filter=%2A&Name=a+b", rawQuery)
+
+	_, err = DoRequest(newQueryRequest(), &RuntimeObject{})
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "Filter=%2A&Name=a+b", rawQuery)
+
+	_, err = DoRequest(newQueryRequest(), &RuntimeObject{QueryEncoding: String("plain")})
+	utils.AssertEqual(t, `dara: unsupported query encoding "plain"`, err.Error())
+}
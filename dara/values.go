@@ -0,0 +1,89 @@
+package dara
+
+import (
+	"net/http"
+)
+
+// AddHeader appends value to the values of header key
+func (request *Request) AddHeader(key, value string) {
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	request.extraHeaders = addValue(request.Headers, request.extraHeaders, key, value)
+}
+
+// HeaderValues returns every value of header key, the one in Headers first
+func (request *Request) HeaderValues(key string) []string {
+	return getValues(request.Headers, request.extraHeaders, key)
+}
+
+// SetHeaderValues replaces the values of header key, Headers keeps the first one
+func (request *Request) SetHeaderValues(key string, values []string) {
+	if request.Headers == nil {
+		request.Headers = make(map[string]*string)
+	}
+	request.extraHeaders = setValues(request.Headers, request.extraHeaders, key, values)
+}
+
+// AddQuery appends value to the values of query parameter key
+func (request *Request) AddQuery(key, value string) {
+	if request.Query == nil {
+		request.Query = make(map[string]*string)
+	}
+	request.extraQuery = addValue(request.Query, request.extraQuery, key, value)
+}
+
+// QueryValues returns every value of query parameter key, the one in Query first
+func (request *Request) QueryValues(key string) []string {
+	return getValues(request.Query, request.extraQuery, key)
+}
+
+// SetQueryValues replaces the values of query parameter key, Query keeps the first one
+func (request *Request) SetQueryValues(key string, values []string) {
+	if request.Query == nil {
+		request.Query = make(map[string]*string)
+	}
+	request.extraQuery = setValues(request.Query, request.extraQuery, key, values)
+}
+
+// HeaderValues returns every value of the response header key ignoring case
+func (response *Response) HeaderValues(key string) []string {
+	if values, ok := response.RawHeaders[http.CanonicalHeaderKey(key)]; ok {
+		return values
+	}
+	return foldValues(response.RawHeaders, key)
+}
+
+// Cookies parses the Set-Cookie headers of the response
+func (response *Response) Cookies() []*http.Cookie {
+	return (&http.Response{Header: response.RawHeaders}).Cookies()
+}
+
+// addValue stores the first value of key in single and the next ones in extra
+func addValue(single map[string]*string, extra map[string][]string, key, value string) map[string][]string {
+	if single[key] == nil {
+		single[key] = String(value)
+		return extra
+	}
+	if extra == nil {
+		extra = make(map[string][]string)
+	}
+	extra[key] = append(extra[key], value)
+	return extra
+}
+
+func getValues(single map[string]*string, extra map[string][]string, key string) []string {
+	if single[key] == nil {
+		return nil
+	}
+	return append([]string{*single[key]}, extra[key]...)
+}
+
+func setValues(single map[string]*string, extra map[string][]string, key string, values []string) map[string][]string {
+	delete(single, key)
+	delete(extra, key)
+	for _, value := range values {
+		extra = addValue(single, extra, key, value)
+	}
+	return extra
+}
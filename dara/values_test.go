@@ -0,0 +1,90 @@
+package dara
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alibabacloud-go/tea/utils"
+)
+
+func Test_RequestValues(t *testing.T) {
+	request := &Request{}
+	utils.AssertNil(t, request.HeaderValues("accept"))
+	request.AddHeader("accept", "application/json")
+	request.AddHeader("accept", "text/xml")
+	utils.AssertEqual(t, "application/json", StringValue(request.Headers["accept"]))
+	utils.AssertEqual(t, []string{"application/json", "text/xml"}, request.HeaderValues("accept"))
+	request.SetHeaderValues("accept", []string{"*/*"})
+	utils.AssertEqual(t, []string{"*/*"}, request.HeaderValues("accept"))
+	request.SetHeaderValues("accept", nil)
+	utils.AssertNil(t, request.Headers["accept"])
+	utils.AssertNil(t, request.HeaderValues("accept"))
+
+	request.AddQuery("tag", "a")
+	request.AddQuery("tag", "b")
+	request.AddQuery("tag", "c")
+	utils.AssertEqual(t, "a", StringValue(request.Query["tag"]))
+	utils.AssertEqual(t, []string{"a", "b", "c"}, request.QueryValues("tag"))
+	request.SetQueryValues("tag", []string{"d", "e"})
+	utils.AssertEqual(t, []string{"d", "e"}, request.QueryValues("tag"))
+
+	// assigning the map keeps working and replaces the first value
+	request.Query["tag"] = String("f")
+	utils.AssertEqual(t, []string{"f", "e"}, request.QueryValues("tag"))
+}
+
+func Test_DoRequestWithMultipleValues(t *testing.T) {
+	origTestHookDo := hookDo
+	defer func() { hookDo = origTestHookDo }()
+	var sent *http.Request
+	hookDo = func(fn func(req *http.Request, transport *http.Transport) (*http.Response, error)) func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+		return func(req *http.Request, transport *http.Transport) (*http.Response, error) {
+			sent = req
+			header := http.Header{}
+			header.Add("Set-Cookie", "a=1")
+			header.Add("Set-Cookie", "b=2")
+			header.Add("Vary", "Accept")
+			header.Add("Vary", "Accept-Encoding")
+			return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+
+	request := NewRequest()
+	request.AddQuery("tag", "a")
+	request.AddQuery("tag", "b")
+	request.Query["single"] = String("value")
+	request.AddHeader("x-acs-tag", "a")
+	request.AddHeader("x-acs-tag", "b")
+	request.AddHeader("user-agent", "first")
+	request.AddHeader("user-agent", "second")
+	response, err := DoRequest(request, nil)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "single=value&tag=a&tag=b", sent.URL.RawQuery)
+	utils.AssertEqual(t, []string{"a", "b"}, sent.Header["x-acs-tag"])
+	utils.AssertEqual(t, []string{"first"}, sent.Header["User-Agent"])
+
+	utils.AssertEqual(t, "a=1", StringValue(response.Headers["set-cookie"]))
+	utils.AssertEqual(t, []string{"a=1", "b=2"}, response.HeaderValues("set-cookie"))
+	utils.AssertEqual(t, []string{"Accept", "Accept-Encoding"}, response.RawHeaders["Vary"])
+	cookies := response.Cookies()
+	utils.AssertEqual(t, 2, len(cookies))
+	utils.AssertEqual(t, "b", cookies[1].Name)
+
+	response = &Response{RawHeaders: http.Header{"link": []string{"</a>", "</b>"}}}
+	utils.AssertEqual(t, []string{"</a>", "</b>"}, response.HeaderValues("Link"))
+	utils.AssertNil(t, response.HeaderValues("vary"))
+}
+
+func Test_ToCurlWithMultipleValues(t *testing.T) {
+	request := NewRequest()
+	request.Headers["host"] = String("example.com")
+	request.AddQuery("Signature", "secret1")
+	request.AddQuery("Signature", "secret2")
+	request.AddQuery("tag", "a")
+	request.AddQuery("tag", "b")
+	command, err := ToCurl(request)
+	utils.AssertNil(t, err)
+	utils.AssertEqual(t, "curl -X GET 'http://example.com?Signature=%2A%2A%2A%2A%2A%2A&Signature=%2A%2A%2A%2A%2A%2A&tag=a&tag=b' -H 'Host: example.com'", command)
+}
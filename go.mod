@@ -7,6 +7,7 @@ require (
 	github.com/alibabacloud-go/tea-utils/v2 v2.0.7
 	github.com/clbanning/mxj/v2 v2.7.0
 	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.15.15
 	github.com/modern-go/reflect2 v1.0.2
 	golang.org/x/net v0.26.0
 )
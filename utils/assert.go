@@ -62,3 +62,14 @@ func AssertContains(t *testing.T, contains string, msgAndArgs ...string) {
 		}
 	}
 }
+
+// CallCounter is implemented by fake clients which keep a call log
+type CallCounter interface {
+	CallCount(method, path string) int
+}
+
+func AssertCallCount(t *testing.T, counter CallCounter, method, path string, expected int) {
+	if actual := counter.CallCount(method, path); actual != expected {
+		t.Errorf("%s %s was called %d times, expected %d", method, path, actual, expected)
+	}
+}
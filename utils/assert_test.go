@@ -15,3 +15,15 @@ func Test_isNil(t *testing.T) {
 	AssertContains(t, "tea test", "test")
 	AssertNotNil(t, "sdk")
 }
+
+type callCounter map[string]int
+
+func (counter callCounter) CallCount(method, path string) int {
+	return counter[method+" "+path]
+}
+
+func Test_AssertCallCount(t *testing.T) {
+	counter := callCounter{"GET /": 2}
+	AssertCallCount(t, counter, "GET", "/", 2)
+	AssertCallCount(t, counter, "POST", "/", 0)
+}
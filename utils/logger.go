@@ -8,7 +8,7 @@ import (
 )
 
 var defaultLoggerTemplate = `{time} {channel}: "{method} {uri} HTTP/{version}" {code} {cost} {hostname}`
-var loggerParam = []string{"{time}", "{start_time}", "{ts}", "{channel}", "{pid}", "{host}", "{method}", "{uri}", "{version}", "{target}", "{hostname}", "{code}", "{error}", "{req_headers}", "{res_body}", "{res_headers}", "{cost}"}
+var loggerParam = []string{"{time}", "{start_time}", "{ts}", "{channel}", "{pid}", "{host}", "{method}", "{uri}", "{version}", "{target}", "{hostname}", "{code}", "{error}", "{req_headers}", "{req_body}", "{res_body}", "{res_headers}", "{cost}"}
 var logChannel string
 
 type Logger struct {
@@ -16,6 +16,8 @@ type Logger struct {
 	formatTemplate string
 	isOpen         bool
 	lastLogMsg     string
+	bodyLimit      int
+	redactKeys     []string
 }
 
 func InitLogMsg(fieldMap map[string]string) {
@@ -52,6 +54,7 @@ func NewLogger(level string, channel string, out io.Writer, template string) *Lo
 		Logger:         log,
 		formatTemplate: template,
 		isOpen:         true,
+		redactKeys:     DefaultRedactKeys,
 	}
 }
 
@@ -79,6 +82,33 @@ func (logger *Logger) GetLastLogMsg() string {
 	return logger.lastLogMsg
 }
 
+// SetBodyLimit enables capturing up to limit bytes of text request and
+// response bodies into {req_body} and {res_body}. 0 disables capturing. A
+// response body is captured as it is read, so the log of the call is printed
+// once the body is read to its end or closed.
+func (logger *Logger) SetBodyLimit(limit int) {
+	logger.bodyLimit = limit
+}
+
+func (logger *Logger) GetBodyLimit() int {
+	if logger == nil {
+		return 0
+	}
+	return logger.bodyLimit
+}
+
+// SetRedactKeys sets the header and field names whose values are masked
+func (logger *Logger) SetRedactKeys(keys []string) {
+	logger.redactKeys = keys
+}
+
+func (logger *Logger) GetRedactKeys() []string {
+	if logger == nil {
+		return nil
+	}
+	return logger.redactKeys
+}
+
 func SetLogChannel(channel string) {
 	logChannel = channel
 }
@@ -44,3 +44,19 @@ func Test_PrintLog(t *testing.T) {
 	logger.PrintLog(fieldMap, errors.New("tea error"))
 	AssertEqual(t, byt.String(), "[INFO]logger_test.go:44: tea tea error\n")
 }
+
+func Test_BodyLimitAndRedactKeys(t *testing.T) {
+	log := new(Logger)
+	AssertEqual(t, 0, log.GetBodyLimit())
+	log.SetBodyLimit(1024)
+	AssertEqual(t, 1024, log.GetBodyLimit())
+
+	AssertNil(t, log.GetRedactKeys())
+	log.SetRedactKeys([]string{"Authorization"})
+	AssertEqual(t, []string{"Authorization"}, log.GetRedactKeys())
+
+	var nilLogger *Logger
+	AssertEqual(t, 0, nilLogger.GetBodyLimit())
+	AssertNil(t, nilLogger.GetRedactKeys())
+	AssertEqual(t, DefaultRedactKeys, NewLogger("", "", nil, "").GetRedactKeys())
+}
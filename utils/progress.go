@@ -1,5 +1,11 @@
 package utils
 
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 // ProgressEventType defines transfer progress event type
 type ProgressEventType int
 
@@ -12,6 +18,9 @@ const (
 	TransferCompletedEvent
 	// TransferFailedEvent transfer encounters an error
 	TransferFailedEvent
+	// ResponseDataEvent response body data, set ConsumedBytes and TotalBytes of
+	// the response body, counted apart from the request body
+	ResponseDataEvent
 )
 
 // ProgressEvent defines progress event
@@ -55,6 +64,203 @@ func GetProgressListener(obj interface{}) ProgressListener {
 	return listener
 }
 
+// ReaderTracker records the bytes transferred by a request.
+// Use its methods when it is shared between goroutines.
 type ReaderTracker struct {
 	CompletedBytes int64
 }
+
+func (tracker *ReaderTracker) GetCompletedBytes() int64 {
+	return atomic.LoadInt64(&tracker.CompletedBytes)
+}
+
+func (tracker *ReaderTracker) SetCompletedBytes(completed int64) {
+	atomic.StoreInt64(&tracker.CompletedBytes, completed)
+}
+
+// AddCompletedBytes adds n and returns the new total
+func (tracker *ReaderTracker) AddCompletedBytes(n int64) int64 {
+	return atomic.AddInt64(&tracker.CompletedBytes, n)
+}
+
+// AggregateProgress is a view of all the transfers of a ProgressAggregator
+type AggregateProgress struct {
+	ConsumedBytes int64
+	TotalBytes    int64
+	Transfers     int
+	Active        int
+	Completed     int
+	Failed        int
+	// InstantRate is the bytes per second over the recent window
+	InstantRate float64
+	// AverageRate is the bytes per second since the first event
+	AverageRate float64
+	// ETA is the estimated remaining time, -1 when a total is unknown or nothing moved yet
+	ETA time.Duration
+}
+
+type transferProgress struct {
+	consumed  int64
+	total     int64
+	completed bool
+	failed    bool
+	// responseConsumed and responseTotal count the response body
+	responseConsumed int64
+	responseTotal    int64
+}
+
+type progressSample struct {
+	time     time.Time
+	consumed int64
+}
+
+// ProgressAggregator combines the progress of many transfers into one view.
+// It is safe for concurrent use.
+type ProgressAggregator struct {
+	sync.Mutex
+	window    time.Duration
+	transfers map[string]*transferProgress
+	samples   []progressSample
+	startTime time.Time
+	now       func() time.Time
+}
+
+// NewProgressAggregator creates an aggregator computing the instant rate over window
+func NewProgressAggregator(window time.Duration) *ProgressAggregator {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &ProgressAggregator{
+		window:    window,
+		transfers: make(map[string]*transferProgress),
+		now:       time.Now,
+	}
+}
+
+type aggregatorListener struct {
+	aggregator *ProgressAggregator
+	name       string
+}
+
+func (listener *aggregatorListener) ProgressChanged(event *ProgressEvent) {
+	listener.aggregator.update(listener.name, event)
+}
+
+// Listener returns the ProgressListener of the transfer called name
+func (aggregator *ProgressAggregator) Listener(name string) ProgressListener {
+	aggregator.Lock()
+	defer aggregator.Unlock()
+	if _, ok := aggregator.transfers[name]; !ok {
+		aggregator.transfers[name] = &transferProgress{}
+	}
+	return &aggregatorListener{aggregator: aggregator, name: name}
+}
+
+func (aggregator *ProgressAggregator) update(name string, event *ProgressEvent) {
+	aggregator.Lock()
+	defer aggregator.Unlock()
+	transfer, ok := aggregator.transfers[name]
+	if !ok {
+		transfer = &transferProgress{}
+		aggregator.transfers[name] = transfer
+	}
+	if event.EventType == ResponseDataEvent {
+		if event.TotalBytes > 0 {
+			transfer.responseTotal = event.TotalBytes
+		}
+		if event.ConsumedBytes > transfer.responseConsumed {
+			transfer.responseConsumed = event.ConsumedBytes
+		}
+	} else {
+		if event.TotalBytes > 0 {
+			transfer.total = event.TotalBytes
+		}
+		if event.ConsumedBytes > transfer.consumed {
+			transfer.consumed = event.ConsumedBytes
+		}
+	}
+	switch event.EventType {
+	case TransferCompletedEvent:
+		transfer.completed = true
+	case TransferFailedEvent:
+		transfer.failed = true
+	}
+
+	now := aggregator.now()
+	if aggregator.startTime.IsZero() {
+		aggregator.startTime = now
+	}
+	aggregator.samples = append(aggregator.samples, progressSample{time: now, consumed: aggregator.consumed()})
+	aggregator.pruneSamples(now)
+}
+
+// pruneSamples drops the samples older than the window before now, but the
+// last of them which starts the window
+func (aggregator *ProgressAggregator) pruneSamples(now time.Time) {
+	for len(aggregator.samples) > 1 && now.Sub(aggregator.samples[1].time) >= aggregator.window {
+		aggregator.samples = aggregator.samples[1:]
+	}
+}
+
+func (aggregator *ProgressAggregator) consumed() int64 {
+	consumed := int64(0)
+	for _, transfer := range aggregator.transfers {
+		consumed += transfer.consumed + transfer.responseConsumed
+	}
+	return consumed
+}
+
+// Snapshot returns the current aggregated progress
+func (aggregator *ProgressAggregator) Snapshot() *AggregateProgress {
+	aggregator.Lock()
+	defer aggregator.Unlock()
+	progress := &AggregateProgress{
+		Transfers: len(aggregator.transfers),
+		ETA:       -1,
+	}
+	knownTotal := true
+	for _, transfer := range aggregator.transfers {
+		progress.ConsumedBytes += transfer.consumed + transfer.responseConsumed
+		progress.TotalBytes += transfer.total + transfer.responseTotal
+		if transfer.total <= 0 && !transfer.completed {
+			knownTotal = false
+		}
+		if transfer.responseConsumed > 0 && transfer.responseTotal <= 0 {
+			knownTotal = false
+		}
+		if transfer.failed {
+			progress.Failed++
+		} else if transfer.completed {
+			progress.Completed++
+		} else {
+			progress.Active++
+		}
+	}
+	now := aggregator.now()
+	if !aggregator.startTime.IsZero() {
+		if elapsed := now.Sub(aggregator.startTime).Seconds(); elapsed > 0 {
+			progress.AverageRate = float64(progress.ConsumedBytes) / elapsed
+		}
+	}
+	// without events in the window the transfers stalled and the rate is 0
+	aggregator.pruneSamples(now)
+	if len(aggregator.samples) > 1 {
+		first := aggregator.samples[0]
+		last := aggregator.samples[len(aggregator.samples)-1]
+		if elapsed := now.Sub(first.time).Seconds(); elapsed > 0 {
+			progress.InstantRate = float64(last.consumed-first.consumed) / elapsed
+		}
+	}
+	rate := progress.InstantRate
+	if rate <= 0 {
+		rate = progress.AverageRate
+	}
+	if knownTotal && rate > 0 {
+		remaining := progress.TotalBytes - progress.ConsumedBytes
+		if remaining < 0 {
+			remaining = 0
+		}
+		progress.ETA = time.Duration(float64(remaining) / rate * float64(time.Second))
+	}
+	return progress
+}
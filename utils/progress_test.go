@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 type Progresstest struct {
@@ -21,3 +23,113 @@ func Test_PublishProgress(t *testing.T) {
 	listener = GetProgressListener(&Progresstest{})
 	PublishProgress(listener, event)
 }
+
+func Test_ReaderTracker(t *testing.T) {
+	tracker := &ReaderTracker{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tracker.AddCompletedBytes(1)
+			}
+		}()
+	}
+	wg.Wait()
+	AssertEqual(t, int64(1000), tracker.GetCompletedBytes())
+	tracker.SetCompletedBytes(5)
+	AssertEqual(t, int64(5), tracker.CompletedBytes)
+}
+
+func Test_ProgressAggregator(t *testing.T) {
+	clock := time.Unix(0, 0)
+	aggregator := NewProgressAggregator(0)
+	aggregator.now = func() time.Time {
+		return clock
+	}
+	progress := aggregator.Snapshot()
+	AssertEqual(t, int64(-1), int64(progress.ETA))
+	AssertEqual(t, 0, progress.Transfers)
+
+	a := aggregator.Listener("a")
+	b := aggregator.Listener("b")
+	a.ProgressChanged(NewProgressEvent(TransferStartedEvent, 0, 100, 0))
+	b.ProgressChanged(NewProgressEvent(TransferStartedEvent, 0, 300, 0))
+	clock = clock.Add(time.Second)
+	a.ProgressChanged(NewProgressEvent(TransferDataEvent, 50, 100, 50))
+	b.ProgressChanged(NewProgressEvent(TransferDataEvent, 50, 300, 50))
+
+	progress = aggregator.Snapshot()
+	AssertEqual(t, int64(100), progress.ConsumedBytes)
+	AssertEqual(t, int64(400), progress.TotalBytes)
+	AssertEqual(t, 2, progress.Active)
+	AssertEqual(t, float64(100), progress.InstantRate)
+	AssertEqual(t, float64(100), progress.AverageRate)
+	AssertEqual(t, 3*time.Second, progress.ETA)
+
+	clock = clock.Add(2 * time.Second)
+	a.ProgressChanged(NewProgressEvent(TransferDataEvent, 100, 100, 50))
+	a.ProgressChanged(NewProgressEvent(TransferCompletedEvent, 100, 100, 0))
+	b.ProgressChanged(NewProgressEvent(TransferDataEvent, 250, 300, 200))
+	b.ProgressChanged(NewProgressEvent(TransferFailedEvent, 250, 300, 0))
+	progress = aggregator.Snapshot()
+	AssertEqual(t, int64(350), progress.ConsumedBytes)
+	AssertEqual(t, 1, progress.Completed)
+	AssertEqual(t, 1, progress.Failed)
+	AssertEqual(t, 0, progress.Active)
+	AssertEqual(t, float64(125), progress.InstantRate)
+	AssertEqual(t, float64(350)/3, progress.AverageRate)
+
+	// the instant rate falls while no event arrives and is 0 after the window
+	clock = clock.Add(time.Second / 2)
+	AssertEqual(t, float64(100), aggregator.Snapshot().InstantRate)
+	clock = clock.Add(time.Second)
+	progress = aggregator.Snapshot()
+	AssertEqual(t, float64(0), progress.InstantRate)
+	AssertEqual(t, float64(350)/4.5, progress.AverageRate)
+
+	// an unknown total makes the ETA unknown
+	aggregator.Listener("c").ProgressChanged(NewProgressEvent(TransferDataEvent, 10, 0, 10))
+	AssertEqual(t, time.Duration(-1), aggregator.Snapshot().ETA)
+	AssertEqual(t, 3, aggregator.Snapshot().Transfers)
+}
+
+func Test_ProgressAggregatorResponse(t *testing.T) {
+	aggregator := NewProgressAggregator(time.Second)
+	listener := aggregator.Listener("a")
+	listener.ProgressChanged(NewProgressEvent(TransferStartedEvent, 0, 8, 0))
+	listener.ProgressChanged(NewProgressEvent(TransferDataEvent, 8, 8, 8))
+	listener.ProgressChanged(NewProgressEvent(TransferCompletedEvent, 8, 8, 0))
+	// the response body does not overwrite the request body
+	listener.ProgressChanged(NewProgressEvent(ResponseDataEvent, 4, 10, 4))
+	progress := aggregator.Snapshot()
+	AssertEqual(t, int64(12), progress.ConsumedBytes)
+	AssertEqual(t, int64(18), progress.TotalBytes)
+	AssertEqual(t, 1, progress.Completed)
+
+	listener.ProgressChanged(NewProgressEvent(ResponseDataEvent, 10, 10, 6))
+	AssertEqual(t, int64(18), aggregator.Snapshot().ConsumedBytes)
+
+	// a response of unknown length makes the ETA unknown
+	aggregator.Listener("b").ProgressChanged(NewProgressEvent(ResponseDataEvent, 5, 0, 5))
+	AssertEqual(t, time.Duration(-1), aggregator.Snapshot().ETA)
+}
+
+func Test_ProgressAggregatorConcurrent(t *testing.T) {
+	aggregator := NewProgressAggregator(time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			listener := aggregator.Listener(string(rune('a' + i)))
+			for j := int64(1); j <= 10; j++ {
+				PublishProgress(listener, NewProgressEvent(TransferDataEvent, j, 10, 1))
+				aggregator.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+	AssertEqual(t, int64(100), aggregator.Snapshot().ConsumedBytes)
+}
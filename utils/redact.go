@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces the value of sensitive headers and fields in logs
+const RedactedValue = "******"
+
+// DefaultRedactKeys lists the header and field names masked by default
+var DefaultRedactKeys = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Acs-Security-Token",
+	"AccessKeySecret",
+	"SecurityToken",
+	"Signature",
+	"AccessKeyId",
+}
+
+// ShouldRedact reports whether key is one of keys, ignoring case
+func ShouldRedact(key string, keys []string) bool {
+	for _, value := range keys {
+		if strings.EqualFold(key, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders returns a copy of header with the values of keys masked
+func RedactHeaders(header map[string][]string, keys []string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+	result := make(map[string][]string, len(header))
+	for key, values := range header {
+		if ShouldRedact(key, keys) {
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = RedactedValue
+			}
+			result[key] = masked
+			continue
+		}
+		result[key] = values
+	}
+	return result
+}
+
+// RedactBody masks the values of keys found in a JSON, XML or form encoded body
+func RedactBody(body string, keys []string) string {
+	for _, key := range keys {
+		name := regexp.QuoteMeta(key)
+		jsonPattern := regexp.MustCompile(`(?i)("` + name + `"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\s]+)`)
+		body = jsonPattern.ReplaceAllString(body, `${1}"`+RedactedValue+`"`)
+		xmlPattern := regexp.MustCompile(`(?i)(<` + name + `>)([^<]*)(</` + name + `>)`)
+		body = xmlPattern.ReplaceAllString(body, "${1}"+RedactedValue+"${3}")
+		formPattern := regexp.MustCompile(`(?i)((?:^|&)` + name + `=)([^&]*)`)
+		body = formPattern.ReplaceAllString(body, "${1}"+RedactedValue)
+	}
+	return body
+}
+
+// RedactQuery masks the values of keys in an encoded query string, keeping
+// the order and encoding of the other parameters
+func RedactQuery(rawQuery string, keys []string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		rawName := param
+		if index := strings.Index(param, "="); index >= 0 {
+			rawName = param[:index]
+		}
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if ShouldRedact(name, keys) {
+			params[i] = rawName + "=" + RedactedValue
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// IsTextContentType reports whether a body of contentType is safe to print.
+// Empty, binary and streaming content types are not.
+func IsTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/x-www-form-urlencoded",
+		"application/javascript", "application/x-javascript":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
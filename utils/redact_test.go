@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+)
+
+func Test_RedactHeaders(t *testing.T) {
+	header := map[string][]string{
+		"Authorization": []string{"acs ak:signature"},
+		"Content-Type":  []string{"application/json"},
+	}
+	result := RedactHeaders(header, DefaultRedactKeys)
+	AssertEqual(t, []string{RedactedValue}, result["Authorization"])
+	AssertEqual(t, []string{"application/json"}, result["Content-Type"])
+	AssertEqual(t, "acs ak:signature", header["Authorization"][0])
+	AssertNil(t, RedactHeaders(nil, DefaultRedactKeys))
+}
+
+func Test_RedactBody(t *testing.T) {
+	body := RedactBody(`{"AccessKeySecret": "secret", "Name":"tea","signature":12}`, DefaultRedactKeys)
+	AssertEqual(t, `{"AccessKeySecret": "******", "Name":"tea","signature":"******"}`, body)
+
+	body = RedactBody(`<Result><SecurityToken>token</SecurityToken><Name>tea</Name></Result>`, DefaultRedactKeys)
+	AssertEqual(t, `<Result><SecurityToken>******</SecurityToken><Name>tea</Name></Result>`, body)
+
+	body = RedactBody(`Action=Test&Signature=abc%3D&Name=tea`, DefaultRedactKeys)
+	AssertEqual(t, `Action=Test&Signature=******&Name=tea`, body)
+
+	body = RedactBody(`Signature=abc`, nil)
+	AssertEqual(t, `Signature=abc`, body)
+}
+
+func Test_RedactQuery(t *testing.T) {
+	query := RedactQuery("Action=Test&AccessKeyId=ak&Signature=abc%3D&security%54oken=t&Name=a+b", DefaultRedactKeys)
+	AssertEqual(t, "Action=Test&AccessKeyId=******&Signature=******&security%54oken=******&Name=a+b", query)
+	AssertEqual(t, "", RedactQuery("", DefaultRedactKeys))
+	AssertEqual(t, "Signature", RedactQuery("Signature", nil))
+}
+
+func Test_IsTextContentType(t *testing.T) {
+	AssertEqual(t, true, IsTextContentType("application/json; charset=utf-8"))
+	AssertEqual(t, true, IsTextContentType("text/xml"))
+	AssertEqual(t, true, IsTextContentType("application/x-www-form-urlencoded"))
+	AssertEqual(t, true, IsTextContentType("application/problem+json"))
+	AssertEqual(t, false, IsTextContentType("text/event-stream"))
+	AssertEqual(t, false, IsTextContentType("application/octet-stream"))
+	AssertEqual(t, false, IsTextContentType("image/png"))
+	AssertEqual(t, false, IsTextContentType(""))
+}